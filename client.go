@@ -5,8 +5,10 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,11 +28,11 @@ const (
 	titleField            = "Title"
 	durationField         = "Duration"
 	optionNumberOfChoices = 5
+	clearedTimeoutSlack   = 500 * time.Millisecond
 )
 
-// Command is a JsonRPC2 Method.  Currently this is exposed in the event that we
-// do not have everything defined in here and we can set these... though there is
-// no way to actually call them directly.
+// Command is a JsonRPC2 Method.  It is exposed so commands without a helper in here
+// can be built with NewCommand and run with Execute.
 type Command string
 
 const (
@@ -40,11 +42,18 @@ const (
 	textInputCommand      Command = "xCommand/UserInterface/Message/TextInput/Display"
 	ratingCommand         Command = "xCommand/UserInterface/Message/Rating/Display"
 	textLineCommand       Command = "xCommand/UserInterface/Message/TextLine/Display"
+	alertClearCommand     Command = "xCommand/UserInterface/Message/Alert/Clear"
+	textLineClearCommand  Command = "xCommand/UserInterface/Message/TextLine/Clear"
+	promptClearCommand    Command = "xCommand/UserInterface/Message/Prompt/Clear"
+	textInputClearCommand Command = "xCommand/UserInterface/Message/TextInput/Clear"
+	ratingClearCommand    Command = "xCommand/UserInterface/Message/Rating/Clear"
 	muteCommand           Command = "xCommand/Audio/Microphones/Mute"
 	unmuteCommand         Command = "xCommand/Audio/Microphones/Unmute"
 	feedbackSusbscribe    Command = "xFeedback/Subscribe"
 	feedbackUnsubscribe   Command = "xFeedback/Unsubscribe"
 	getCommand            Command = "xGet"
+	setCommand            Command = "xSet"
+	commandPrefix                 = "xCommand"
 )
 
 type (
@@ -59,6 +68,28 @@ type (
 	TextInputType string
 )
 
+// PromptOptions configures the dialog shown by Prompt.
+type PromptOptions struct {
+	// Title of the prompt, optional.
+	Title string
+	// Text shown above the options.
+	Text string
+	// Options are the choices the user can pick from.  One to five options are allowed.
+	Options []string
+	// Duration the prompt is shown for.  Zero keeps it on screen until the user answers
+	// or dismisses it.
+	Duration time.Duration
+}
+
+// PromptResult is how a prompt went away.  When an option was picked OptionID is the
+// one based index into PromptOptions.Options and Option its text.
+type PromptResult struct {
+	OptionID int
+	Option   string
+	Cleared  bool
+	TimedOut bool
+}
+
 const (
 	// SingleLine TextInput type.
 	SingleLine TextInputType = "SingleLine"
@@ -133,18 +164,54 @@ type rpcClient interface {
 
 // Client is the main client that handles all communication to/from the WebEx device.
 type Client struct {
-	User          string
-	Password      string
-	Insecure      bool
-	URL           string
-	client        rpcClient
-	seq           float64
-	seqlock       sync.Mutex
-	cblock        sync.Mutex
-	rclock        sync.Mutex
-	callbacks     map[Path]CallbackFunc
-	responseChans map[float64]chan interface{}
-	OnConnectFunc func(*Client)
+	User     string
+	Password string
+	Insecure bool
+	URL      string
+	// Logger receives connection, subscription and dropped event logs.  At debug
+	// level it also gets every JSON-RPC frame with secrets redacted.
+	Logger Logger
+	// Metrics is an optional hook that receives request latencies, event counts and
+	// connection state.
+	Metrics Metrics
+	// Tracer is an optional hook that traces every command and callback.
+	Tracer Tracer
+	// ErrorHandler decides what to do with recoverable run loop errors such as late
+	// responses or events without a subscriber.  When nil they are logged and the run
+	// loop keeps going.  Transport errors always end Run.
+	ErrorHandler ErrorHandler
+	// Dispatch picks how event callbacks are run, by default each in its own goroutine.
+	Dispatch DispatchMode
+	// DispatchWorkers is the number of workers for DispatchPool, defaults to 8.
+	DispatchWorkers int
+	// DispatchQueueSize limits how many callbacks can wait to run in each serial queue
+	// and in the pool.  Events beyond that are dropped and reported to the ErrorHandler
+	// and Metrics with ErrDispatchQueueFull.  Zero never drops events, the queues then
+	// grow for as long as callbacks are slower than the events coming in.
+	DispatchQueueSize int
+	serialQueues      map[uint64]*executor
+	pool              *executor
+	connects          int
+	client            rpcClient
+	seq               float64
+	seqlock           sync.Mutex
+	cblock            sync.Mutex
+	rclock            sync.Mutex
+	wlock             sync.Mutex
+	hlock             sync.Mutex
+	handlers          map[string]MethodHandler
+	callbacks         map[Path]map[uint64]*subscription
+	subscribes        map[Path]*subscribeState
+	subseq            uint64
+	dialogSlot        chan struct{}
+	dialogGone        chan struct{}
+	dialogs           map[*dialog]func(error)
+	messages          map[Command]*Message
+	responseChans     map[float64]chan interface{}
+	connected         bool
+	OnConnectFunc     func(*Client)
+	hooklock          sync.Mutex
+	connectHooks      []func(*Client)
 }
 
 // Connect to the Webex device.
@@ -159,8 +226,15 @@ func (c *Client) ConnectContext(ctx context.Context) error {
 		InsecureSkipVerify: c.Insecure,
 	}
 
-	c.callbacks = make(map[Path]CallbackFunc)
-	c.responseChans = make(map[float64]chan interface{})
+	c.cblock.Lock()
+	c.callbacks = make(map[Path]map[uint64]*subscription)
+	c.subscribes = make(map[Path]*subscribeState)
+	c.serialQueues = nil
+	c.dialogSlot = make(chan struct{}, 1)
+	c.dialogGone = make(chan struct{})
+	c.dialogs = make(map[*dialog]func(error))
+	c.messages = make(map[Command]*Message)
+	c.cblock.Unlock()
 
 	encpw, err := encCreds(c.User, c.Password)
 	if err != nil {
@@ -170,8 +244,16 @@ func (c *Client) ConnectContext(ctx context.Context) error {
 	header := http.Header{}
 	header.Add(credHeader, encpw)
 
+	c.log().Debug("dialing", "url", c.URL, "user", c.User, credHeader, redacted)
+
 	wsc, hr, err := wsd.DialContext(ctx, c.URL, header)
 	if err != nil {
+		c.log().Error("connect failed", "url", c.URL, "error", err)
+
+		if hr != nil && (hr.StatusCode == http.StatusUnauthorized || hr.StatusCode == http.StatusForbidden) {
+			return fmt.Errorf("dial: %s: %w", hr.Status, ErrUnauthorized)
+		}
+
 		return fmt.Errorf("dial: %w", err)
 	}
 
@@ -180,15 +262,49 @@ func (c *Client) ConnectContext(ctx context.Context) error {
 		return fmt.Errorf("connect: %w", err)
 	}
 
-	c.client = &jsonrpc2ws.Client{Conn: wsc}
+	var rpc rpcClient = &jsonrpc2ws.Client{Conn: wsc}
+	if c.Logger != nil {
+		rpc = &traceClient{rpcClient: rpc, log: c.Logger}
+	}
+
+	c.wlock.Lock()
+	c.client = rpc
+	c.wlock.Unlock()
+
+	c.rclock.Lock()
+	c.responseChans = make(map[float64]chan interface{})
+	c.connected = true
+	c.connects++
+	reconnect := c.connects > 1
+	c.rclock.Unlock()
+
+	c.log().Info("connected", "url", c.URL)
+
+	c.metrics().Connected(reconnect)
+	c.metrics().SubscriptionsChanged(0)
 
 	if c.OnConnectFunc != nil {
 		go c.OnConnectFunc(c)
 	}
 
+	c.hooklock.Lock()
+	for _, h := range c.connectHooks {
+		go h(c)
+	}
+	c.hooklock.Unlock()
+
 	return nil
 }
 
+// onConnect registers a hook that is run every time the client connects
+// alongside OnConnectFunc.  Helpers like Widgets use this to restore their
+// state on the device after a reconnect.
+func (c *Client) onConnect(hook func(*Client)) {
+	c.hooklock.Lock()
+	defer c.hooklock.Unlock()
+	c.connectHooks = append(c.connectHooks, hook)
+}
+
 // Run is the client's main run loop.  This blocks till disconnect
 // or a non recoverable error happens.
 func (c *Client) Run() error {
@@ -206,42 +322,55 @@ func (c *Client) Run() error {
 func (c *Client) runLoop() error {
 	_, msg, err := c.client.ReadMessage()
 	if err != nil {
+		var (
+			syntaxErr *json.SyntaxError
+			typeErr   *json.UnmarshalTypeError
+		)
+
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			return c.loopError(&LoopError{Op: OpDecode, Err: err})
+		}
+
+		c.log().Info("disconnected", "url", c.URL, "error", err)
+		c.metrics().Disconnected()
+		c.disconnected(err)
+
 		return fmt.Errorf("runloop: %w", err)
 	}
 
 	switch msg.GetType() {
 	case jsonrpc2.TypeRequestMsg:
-		return fmt.Errorf("type request: %w", ErrUnsupportedMsg)
+		c.handleRequest(msg)
 
 	case jsonrpc2.TypeErrorMsg:
-		if err := c.chanResponse(msg, JSONRPCError{
-			Code:    float64(msg.Error.Code),
-			Message: msg.Error.Message,
-			Data:    msg.Error.Data,
-		}); err != nil {
-			return err
+		if err := c.chanResponse(msg, newJSONRPCError(float64(msg.Error.Code),
+			msg.Error.Message, msg.Error.Data)); err != nil {
+			return c.loopError(newLoopError(OpResponse, msg, err))
 		}
 
 	case jsonrpc2.TypeInvalidMsg:
 		if err := c.chanResponse(msg, ErrInvalidMsg); err != nil {
-			return err
+			return c.loopError(newLoopError(OpResponse, msg, err))
 		}
 
 	case jsonrpc2.TypeSuccessMsg:
 		var res interface{}
 
-		err := json.Unmarshal([]byte(*msg.Result), &res)
-		if err != nil {
-			return err
+		if err := json.Unmarshal([]byte(*msg.Result), &res); err != nil {
+			// fail the waiting request rather than leaving it hanging.
+			err = fmt.Errorf("decode result: %w", err)
+			_ = c.chanResponse(msg, err)
+
+			return c.loopError(newLoopError(OpDecode, msg, err))
 		}
 
 		if err := c.chanResponse(msg, res); err != nil {
-			return err
+			return c.loopError(newLoopError(OpResponse, msg, err))
 		}
 
 	case jsonrpc2.TypeNotificationMsg:
 		if err := c.runCallbacks(msg); err != nil {
-			return err
+			return c.loopError(newLoopError(OpEvent, msg, err))
 		}
 	}
 
@@ -254,13 +383,20 @@ func (c *Client) runCallbacks(msg *jsonrpc2.JsonRpcMessage) error {
 		return fmt.Errorf("running callback: %w", err)
 	}
 
+	type match struct {
+		id   uint64
+		path Path
+		sub  *subscription
+		res  []interface{}
+	}
+
 	var (
-		cbFunc CallbackFunc
-		res    []interface{}
+		matches []match
+		found   bool
 	)
 
 	c.cblock.Lock()
-	for k, v := range c.callbacks {
+	for k, subs := range c.callbacks {
 		cjp, err := jp.ParseString(k.toJSONPath())
 		if err != nil {
 			c.cblock.Unlock()
@@ -269,27 +405,80 @@ func (c *Client) runCallbacks(msg *jsonrpc2.JsonRpcMessage) error {
 		}
 
 		r := cjp.Get(event)
+		if len(r) == 0 {
+			continue
+		}
 
-		if len(r) > 0 && v != nil {
-			res = r
-			cbFunc = v
+		found = true
 
-			break
+		c.metrics().EventReceived(k)
+
+		for id, v := range subs {
+			if v != nil {
+				matches = append(matches, match{id: id, path: k, sub: v, res: r})
+			}
 		}
 	}
 	c.cblock.Unlock()
 
-	if res == nil {
+	if !found {
+		c.metrics().EventDropped(ErrMissingData)
+
 		return ErrMissingData
 	}
 
-	if cbFunc == nil {
+	if len(matches) == 0 {
+		c.metrics().EventDropped(ErrMissingCallback)
+
 		return ErrMissingCallback
 	}
 
-	go cbFunc(res)
+	var res error
 
-	return nil
+	for _, m := range matches {
+		if err := c.dispatch(m.id, m.path, m.sub, m.res); err != nil {
+			res = err
+		}
+	}
+
+	return res
+}
+
+// disconnected fails every request still waiting for a response, as none will come
+// over the lost connection.
+func (c *Client) disconnected(cause error) {
+	c.rclock.Lock()
+	pending := c.responseChans
+	c.responseChans = make(map[float64]chan interface{})
+	c.connected = false
+	c.rclock.Unlock()
+
+	err := fmt.Errorf("%w: %v", ErrDisconnected, cause)
+
+	for _, ch := range pending {
+		select {
+		case ch <- err:
+		default:
+		}
+	}
+
+	// dialogs shown on this connection can't be answered anymore and dialogs still
+	// waiting for the slot would be shown on the next one, so both are failed.
+	c.cblock.Lock()
+	dialogs := c.dialogs
+	c.dialogs = make(map[*dialog]func(error))
+	if c.dialogGone != nil {
+		select {
+		case <-c.dialogGone:
+		default:
+			close(c.dialogGone)
+		}
+	}
+	c.cblock.Unlock()
+
+	for d, cb := range dialogs {
+		go d.disconnect(err, cb)
+	}
 }
 
 // ConnectAndRun is a helper to connect and start the run loop.
@@ -303,79 +492,166 @@ func (c *Client) ConnectAndRun() error {
 
 // Close and disconnect from the Webex.
 func (c *Client) Close() error {
-	if err := c.client.Close(); err != nil {
+	c.wlock.Lock()
+	rpc := c.client
+	c.wlock.Unlock()
+
+	if rpc == nil {
+		return ErrNotConnected
+	}
+
+	c.disconnected(errors.New("closed"))
+
+	if err := rpc.Close(); err != nil {
 		return fmt.Errorf("xapi client close: %w", err)
 	}
 
+	c.log().Info("closed", "url", c.URL)
+
 	return nil
 }
 
 // Alert displays an Alert in the UI of the device, this shows up in the upper right corner on a Desk Pro.
-func (c *Client) Alert(title string, text string, duration time.Duration) error {
+// The returned Message can be used to clear the alert or to wait for the user to dismiss it.
+func (c *Client) Alert(title string, text string, duration time.Duration) (*Message, error) {
+	return c.AlertContext(context.Background(), title, text, duration)
+}
+
+// AlertContext is Alert with a context bounding the commands sent to show the alert.
+func (c *Client) AlertContext(ctx context.Context, title string, text string,
+	duration time.Duration) (*Message, error) {
 	args := map[string]interface{}{
 		titleField:    title,
 		textField:     text,
 		durationField: duration.Seconds(),
 	}
 
-	_, err := c.sendCommand(alertCommand, args)
+	return c.showMessage(ctx, alertMessage, alertCommand, args, duration)
+}
+
+// AlertClear removes the alert currently shown on the device.
+func (c *Client) AlertClear() error {
+	_, err := c.sendCommand(alertMessage.clear, nil)
 
 	return err
 }
 
 // TextLine displays text centered on the screen.  There is no way to dismiss this from
-// the UI and requires the timeout to be a non zero value, or to be cleared with a call to TextLineClear.
-func (c *Client) TextLine(text string, duration time.Duration) error {
+// the UI and requires the timeout to be a non zero value, or to be cleared with a call to
+// TextLineClear or Clear on the returned Message.
+func (c *Client) TextLine(text string, duration time.Duration) (*Message, error) {
+	return c.TextLineContext(context.Background(), text, duration)
+}
+
+// TextLineContext is TextLine with a context bounding the commands sent to show the text.
+func (c *Client) TextLineContext(ctx context.Context, text string, duration time.Duration) (*Message, error) {
 	args := map[string]interface{}{
 		textField:     text,
 		durationField: duration.Seconds(),
 	}
 
-	_, err := c.sendCommand(textLineCommand, args)
+	return c.showMessage(ctx, textLineMessage, textLineCommand, args, duration)
+}
+
+// TextLineClear removes the text line currently shown on the device.
+func (c *Client) TextLineClear() error {
+	_, err := c.sendCommand(textLineMessage.clear, nil)
 
 	return err
 }
 
-// Prompt displays a UI prompt with multiple options.
-// TODO Duration and title are optional.
-// TODO we should also have a callback for the UI prompt going away
-// with a timeout.
-func (c *Client) Prompt(title string, text string,
-	options *[optionNumberOfChoices]string, cb func(string, error)) error {
+// Prompt displays a UI prompt with between one and five options.  The callback is
+// called exactly once when the user picks an option, dismisses the prompt or the
+// prompt times out.  The event subscriptions are removed before the callback is run.
+// If another dialog is on the screen Prompt waits for it to finish first, use
+// PromptContext to bound the wait.  A lost connection calls cb with ErrDisconnected.
+func (c *Client) Prompt(opts PromptOptions, cb func(PromptResult, error)) error {
+	return c.PromptContext(context.Background(), opts, cb)
+}
+
+// PromptContext is Prompt with a context.  ctx bounds the wait for the dialog slot and
+// the prompt itself, when ctx ends before the user answers the prompt is cleared and
+// cb is called with the context error.
+func (c *Client) PromptContext(ctx context.Context, opts PromptOptions, cb func(PromptResult, error)) error {
+	if len(opts.Options) < 1 || len(opts.Options) > optionNumberOfChoices {
+		return fmt.Errorf("prompt with %d options: %w", len(opts.Options), ErrInvalidOptions)
+	}
+
+	d, err := c.newDialog(ctx, "prompt")
+	if err != nil {
+		return err
+	}
+
 	args := map[string]interface{}{
-		"FeedbackId": "go-prompt-id",
-		titleField:   title,
-		textField:    text,
+		feedbackIDField: d.feedbackID,
+		textField:       opts.Text,
 	}
 
-	for i, v := range options {
+	if opts.Title != "" {
+		args[titleField] = opts.Title
+	}
+
+	if opts.Duration > 0 {
+		args[durationField] = opts.Duration.Seconds()
+	}
+
+	for i, v := range opts.Options {
 		args[fmt.Sprintf("Option.%d", i+1)] = v
 	}
 
-	if _, err := c.Subscribe(EventUserInterfacePromptResponse, func(data []interface{}) {
-		x := data[0].(map[string]interface{})["OptionId"].(int64)
+	finish := func(res PromptResult, err error) {
+		d.finish(err, func(err error) {
+			cb(res, err)
+		})
+	}
 
-		x--
+	shown := time.Now()
 
-		err := c.cancelFunc(EventUserInterfacePromptResponse)()
+	if err := d.on(EventUserInterfacePromptResponse, func(data []interface{}) {
+		x, ok := toInt(mapField(data, "OptionId"))
+		if !ok || x < 1 || int(x) > len(opts.Options) {
+			finish(PromptResult{}, fmt.Errorf("prompt option %v: %w", x, ErrUnknownResponse))
 
-		cb(options[int(x)], err)
-	}); err != nil {
-		if cerr := c.cancelFunc(EventUserInterfacePromptResponse)(); cerr != nil {
-			err = multierror.Append(err, cerr)
+			return
 		}
 
-		return err
+		finish(PromptResult{OptionID: int(x), Option: opts.Options[x-1]}, nil)
+	}); err != nil {
+		return d.abort(err)
 	}
 
-	_, err := c.sendCommand(promptCommand, args)
+	if err := d.on(EventUserInterfaceMessagePromptCleared, func([]interface{}) {
+		timedOut := opts.Duration > 0 && time.Since(shown) >= opts.Duration-clearedTimeoutSlack
+		finish(PromptResult{Cleared: !timedOut, TimedOut: timedOut}, nil)
+	}); err != nil {
+		return d.abort(err)
+	}
 
-	return err
+	if _, err := c.sendCommandContext(ctx, promptCommand, args); err != nil {
+		return d.abort(err)
+	}
+
+	d.watch(ctx, promptClearCommand, func(err error) {
+		cb(PromptResult{}, err)
+	})
+
+	if opts.Duration > 0 {
+		d.after(opts.Duration+clearedTimeoutSlack, func() {
+			finish(PromptResult{TimedOut: true}, nil)
+		})
+	}
+
+	return nil
 }
 
 // SetWidgetValue updates a UI widget with a new value.
 func (c *Client) SetWidgetValue(widgetID string, value interface{}) error {
-	_, err := c.sendCommand(widgetSetValueCommand, map[string]interface{}{
+	return c.SetWidgetValueContext(context.Background(), widgetID, value)
+}
+
+// SetWidgetValueContext is SetWidgetValue with a context.
+func (c *Client) SetWidgetValueContext(ctx context.Context, widgetID string, value interface{}) error {
+	_, err := c.sendCommandContext(ctx, widgetSetValueCommand, map[string]interface{}{
 		"WidgetId": widgetID,
 		"Value":    value,
 	})
@@ -384,112 +660,346 @@ func (c *Client) SetWidgetValue(widgetID string, value interface{}) error {
 }
 
 // TextInput lets you prompt a user for a free form text string.  When the user submits
-// the text the callback is called with the response passed in.
+// the text the callback is called with the response passed in.  If another dialog is on
+// the screen TextInput waits for it to finish first, use TextInputContext to bound
+// the wait.  A lost connection calls cb with ErrDisconnected.
 func (c *Client) TextInput(text string, cb func(canceled bool, response string, err error), opts ...TextInputOption) error {
+	return c.TextInputContext(context.Background(), text, cb, opts...)
+}
+
+// TextInputContext is TextInput with a context.  ctx bounds the wait for the dialog
+// slot and the dialog itself, when ctx ends first the dialog is cleared and cb is
+// called with the context error.
+func (c *Client) TextInputContext(ctx context.Context, text string,
+	cb func(canceled bool, response string, err error), opts ...TextInputOption) error {
+	d, err := c.newDialog(ctx, "text-input")
+	if err != nil {
+		return err
+	}
+
 	args := map[string]interface{}{
-		"FeedbackId": "go-text-input-id",
-		textField:    text,
+		feedbackIDField: d.feedbackID,
+		textField:       text,
 	}
 
 	for _, v := range opts {
 		v(args)
 	}
 
-	canFunc := func() error {
-		var res error
-		if err := c.cancelFunc(EventUserInterfaceTextInputResponse)(); err != nil {
-			res = multierror.Append(res, err)
-		}
-
-		if err := c.cancelFunc(EventUserInterfaceTextInputResponseClear)(); err != nil {
-			res = multierror.Append(res, err)
-		}
-
-		return res
-	}
-
-	if _, err := c.Subscribe(EventUserInterfaceTextInputResponse,
+	if err := d.on(EventUserInterfaceTextInputResponse,
 		func(data []interface{}) {
-			err := canFunc()
-			cb(false, data[0].(map[string]interface{})[textField].(string), err)
+			response, _ := mapField(data, textField).(string)
+			d.finish(nil, func(err error) {
+				cb(false, response, err)
+			})
 		}); err != nil {
-		return multierror.Append(err, canFunc())
+		return d.abort(err)
 	}
 
-	if _, err := c.Subscribe(EventUserInterfaceTextInputResponseClear,
+	if err := d.on(EventUserInterfaceTextInputResponseClear,
 		func(data []interface{}) {
-			err := canFunc()
-			cb(true, "", err)
+			d.finish(nil, func(err error) {
+				cb(true, "", err)
+			})
 		}); err != nil {
-		return multierror.Append(err, canFunc())
+		return d.abort(err)
 	}
 
-	_, err := c.sendCommand(textInputCommand, args)
+	if _, err := c.sendCommandContext(ctx, textInputCommand, args); err != nil {
+		return d.abort(err)
+	}
 
-	return err
+	d.watch(ctx, textInputClearCommand, func(err error) {
+		cb(true, "", err)
+	})
+
+	return nil
 }
 
 // Rating opens a '5 star' rating dialog on the Webex device.  A user can
 // cancel the prompt or choose a number of stars.  The rating is returned
-// as an int64.
+// as an int64.  If another dialog is on the screen Rating waits for it to
+// finish first, use RatingContext to bound the wait.  A lost connection calls
+// callback with ErrDisconnected.
 func (c *Client) Rating(title string, text string, callback func(canceled bool, value int64, err error)) error {
-	args := map[string]interface{}{
-		"FeedbackId": "go-rating-id",
-		titleField:   title,
-		textField:    text,
-	}
-
-	cleanup := func() error {
-		var res error
-		if err := c.cancelFunc(EventUserInterfaceRatingResponse)(); err != nil {
-			res = multierror.Append(res, err)
-		}
+	return c.RatingContext(context.Background(), title, text, callback)
+}
 
-		if err := c.cancelFunc(EventUserInterfaceMessageRatingCleared)(); err != nil {
-			res = multierror.Append(res, err)
-		}
+// RatingContext is Rating with a context.  ctx bounds the wait for the dialog slot and
+// the dialog itself, when ctx ends first the dialog is cleared and callback is called
+// with the context error.
+func (c *Client) RatingContext(ctx context.Context, title string, text string,
+	callback func(canceled bool, value int64, err error)) error {
+	d, err := c.newDialog(ctx, "rating")
+	if err != nil {
+		return err
+	}
 
-		return res
+	args := map[string]interface{}{
+		feedbackIDField: d.feedbackID,
+		titleField:      title,
+		textField:       text,
 	}
 
-	if _, err := c.Subscribe(EventUserInterfaceRatingResponse,
+	if err := d.on(EventUserInterfaceRatingResponse,
 		func(data []interface{}) {
-			x := data[0].(map[string]interface{})["Rating"].(int64)
-
-			callback(false, x, cleanup())
+			x, ok := toInt(mapField(data, "Rating"))
+			if !ok {
+				d.finish(fmt.Errorf("rating %v: %w", mapField(data, "Rating"), ErrUnknownResponse), func(err error) {
+					callback(false, 0, err)
+				})
+
+				return
+			}
+
+			d.finish(nil, func(err error) {
+				callback(false, x, err)
+			})
 		}); err != nil {
-		return multierror.Append(err, cleanup())
+		return d.abort(err)
 	}
 
-	if _, err := c.Subscribe(EventUserInterfaceMessageRatingCleared,
+	if err := d.on(EventUserInterfaceMessageRatingCleared,
 		func(data []interface{}) {
-			callback(true, 0, cleanup())
+			d.finish(nil, func(err error) {
+				callback(true, 0, err)
+			})
 		}); err != nil {
-		return multierror.Append(err, cleanup())
+		return d.abort(err)
 	}
 
-	_, err := c.sendCommand(ratingCommand, args)
+	if _, err := c.sendCommandContext(ctx, ratingCommand, args); err != nil {
+		return d.abort(err)
+	}
+
+	d.watch(ctx, ratingClearCommand, func(err error) {
+		callback(true, 0, err)
+	})
+
+	return nil
+}
+
+// PromptClear removes the prompt currently shown on the device.
+func (c *Client) PromptClear() error {
+	_, err := c.sendCommand(promptClearCommand, nil)
+
+	return err
+}
+
+// TextInputClear removes the text input dialog currently shown on the device.
+func (c *Client) TextInputClear() error {
+	_, err := c.sendCommand(textInputClearCommand, nil)
+
+	return err
+}
+
+// RatingClear removes the rating dialog currently shown on the device.
+func (c *Client) RatingClear() error {
+	_, err := c.sendCommand(ratingClearCommand, nil)
 
 	return err
 }
 
 // Subscribe lets you subscribe to event, UI or status change events of the Webex device.
-func (c *Client) Subscribe(path Path, callback CallbackFunc) (func() error, error) {
-	_, err := c.sendCommand(feedbackSusbscribe, path.toSubQuery())
-	if err != nil {
+// Several callbacks can subscribe to the same path, the device subscription is only
+// removed when the last of them is canceled.  Options such as WithDebounce coalesce
+// bursts of events before they reach the callback.
+func (c *Client) Subscribe(path Path, callback CallbackFunc, opts ...SubscribeOption) (func() error, error) {
+	return c.SubscribeContext(context.Background(), path, callback, opts...)
+}
+
+// SubscribeContext is Subscribe with a context.  ctx only bounds the subscribe command
+// sent to the device, the subscription itself lasts till it is canceled.
+func (c *Client) SubscribeContext(ctx context.Context, path Path, callback CallbackFunc,
+	opts ...SubscribeOption) (func() error, error) {
+	if err := path.Validate(); err != nil {
 		return nil, err
 	}
 
+	o := subscribeOptions{}
+	for _, v := range opts {
+		v(&o)
+	}
+
+	sub := &subscription{cb: callback, serial: o.serial, inline: o.inline}
+
+	if o.coalesce() {
+		// the coalescer has to see the events in order to keep the last one.
+		sub.serial = true
+		sub.coalesced = true
+		sub.cb = newCoalescer(o, func(data []interface{}) {
+			c.safeCallback(path, callback, data)
+		}).handle
+	}
+
 	c.cblock.Lock()
-	defer c.cblock.Unlock()
-	c.callbacks[path] = callback
+	if c.callbacks == nil {
+		c.cblock.Unlock()
+
+		return nil, ErrNotConnected
+	}
+
+	if c.subscribes == nil {
+		c.subscribes = make(map[Path]*subscribeState)
+	}
+
+	subs, ok := c.callbacks[path]
+	if !ok {
+		subs = make(map[uint64]*subscription)
+		c.callbacks[path] = subs
+		c.subscribes[path] = &subscribeState{done: make(chan struct{})}
+	}
+	c.subseq++
+	id := c.subseq
+	subs[id] = sub
+	state := c.subscribes[path]
+	c.cblock.Unlock()
+
+	if ok {
+		// the path is subscribed, or being subscribed by an earlier call whose
+		// result is shared.
+		select {
+		case <-state.done:
+		case <-ctx.Done():
+			_ = c.cancelFunc(path, id)()
+
+			return nil, fmt.Errorf("waiting for subscribe %s: %w", path, ctx.Err())
+		}
+
+		if state.err != nil {
+			return nil, state.err
+		}
+
+		return c.cancelFunc(path, id), nil
+	}
+
+	_, err := c.sendCommandContext(ctx, feedbackSusbscribe, path.toSubQuery())
+	if err != nil {
+		// every subscriber waiting on this subscribe fails with it, the next
+		// Subscribe of the path starts over.
+		c.cblock.Lock()
+		if c.subscribes[path] == state {
+			for k := range c.callbacks[path] {
+				delete(c.serialQueues, k)
+			}
 
-	return c.cancelFunc(path), nil
+			delete(c.callbacks, path)
+			delete(c.subscribes, path)
+		}
+		c.cblock.Unlock()
+
+		state.err = err
+		close(state.done)
+
+		c.log().Error("subscribe failed", "path", path, "error", err)
+
+		return nil, err
+	}
+
+	close(state.done)
+
+	c.log().Info("subscribed", "path", path)
+	c.subscriptionsChanged()
+
+	return c.cancelFunc(path, id), nil
 }
 
 // Get retrieve the value of a setting, status or UI element.
 func (c *Client) Get(path Path) (interface{}, error) {
-	return c.sendCommand(getCommand, path.toGetParams())
+	return c.GetContext(context.Background(), path)
+}
+
+// GetContext is Get with a context.  It gives up waiting for the device when ctx ends
+// and the context is passed on to the Tracer.
+func (c *Client) GetContext(ctx context.Context, path Path) (interface{}, error) {
+	if err := path.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.sendCommandContext(ctx, getCommand, path.toGetParams())
+}
+
+// GetMany retrieves several values in one round trip by pipelining the requests over
+// the connection.  The values that could be read are returned keyed by path, and the
+// errors for the others are combined in a multierror.
+func (c *Client) GetMany(paths ...Path) (map[Path]interface{}, error) {
+	return c.GetManyContext(context.Background(), paths...)
+}
+
+// GetManyContext is GetMany with a context.
+func (c *Client) GetManyContext(ctx context.Context, paths ...Path) (map[Path]interface{}, error) {
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		errs error
+		res  = make(map[Path]interface{}, len(paths))
+	)
+
+	for _, p := range paths {
+		wg.Add(1)
+
+		go func(p Path) {
+			defer wg.Done()
+
+			v, err := c.GetContext(ctx, p)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("get %s: %w", p, err))
+
+				return
+			}
+
+			res[p] = v
+		}(p)
+	}
+
+	wg.Wait()
+
+	return res, errs
+}
+
+// NewCommand builds the Command for an xCommand from its nodes, such as
+// NewCommand("Audio", "Volume", "Set").  Nodes may also be given as a single space
+// separated string.
+func NewCommand(nodes ...string) Command {
+	return Command(commandPrefix + "/" + strings.Join(strings.Fields(strings.Join(nodes, " ")), "/"))
+}
+
+// Execute runs any xCommand on the device with the given parameters and returns its
+// result.  params may be nil for commands without parameters.
+func (c *Client) Execute(command Command, params map[string]interface{}) (interface{}, error) {
+	return c.ExecuteContext(context.Background(), command, params)
+}
+
+// ExecuteContext is Execute with a context.
+func (c *Client) ExecuteContext(ctx context.Context, command Command, params map[string]interface{}) (interface{}, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	return c.sendCommandContext(ctx, command, params)
+}
+
+// Set changes a configuration value, such as "Configuration Audio DefaultVolume".
+func (c *Client) Set(path Path, value interface{}) error {
+	return c.SetContext(context.Background(), path, value)
+}
+
+// SetContext is Set with a context.
+func (c *Client) SetContext(ctx context.Context, path Path, value interface{}) error {
+	if err := path.Validate(); err != nil {
+		return err
+	}
+
+	_, err := c.sendCommandContext(ctx, setCommand, map[string]interface{}{
+		"Path":  path.jsonArray(),
+		"Value": value,
+	})
+
+	return err
 }
 
 func (c *Client) Mute() error {
@@ -516,28 +1026,87 @@ func (c *Client) chanResponse(msg *jsonrpc2.JsonRpcMessage, res interface{}) err
 		return ErrMissingChannel
 	}
 
-	ch <- res
+	select {
+	case ch <- res:
+	default:
+	}
 
 	return nil
 }
 
-func (c *Client) cancelFunc(path Path) func() error {
+func (c *Client) cancelFunc(path Path, id uint64) func() error {
 	return func() error {
-		c.cblock.Lock()
-		defer c.cblock.Unlock()
-		delete(c.callbacks, path)
+		if !c.removeCallback(path, id) {
+			return nil
+		}
 
 		_, err := c.sendCommand(feedbackUnsubscribe, path.toSubQuery())
+		if err != nil {
+			c.log().Error("unsubscribe failed", "path", path, "error", err)
+		} else {
+			c.log().Info("unsubscribed", "path", path)
+		}
+
+		c.subscriptionsChanged()
 
 		return err
 	}
 }
 
-func (c *Client) sendCommand(command Command, params interface{}) (interface{}, error) {
-	if c.client == nil {
-		return nil, ErrNotConnected
+// removeCallback removes a single subscriber of path and reports if it was
+// the last one, meaning the device subscription can be dropped.
+func (c *Client) removeCallback(path Path, id uint64) bool {
+	c.cblock.Lock()
+	defer c.cblock.Unlock()
+
+	subs, ok := c.callbacks[path]
+	if !ok {
+		return false
 	}
 
+	if _, ok := subs[id]; !ok {
+		return false
+	}
+
+	delete(subs, id)
+	delete(c.serialQueues, id)
+
+	if len(subs) > 0 {
+		return false
+	}
+
+	delete(c.callbacks, path)
+	delete(c.subscribes, path)
+
+	return true
+}
+
+func (c *Client) sendCommand(command Command, params interface{}) (interface{}, error) {
+	return c.sendCommandContext(context.Background(), command, params)
+}
+
+func (c *Client) sendCommandContext(ctx context.Context, command Command, params interface{}) (interface{}, error) {
+	ctx, span := c.tracer().Start(ctx, string(command), map[string]interface{}{
+		AttrMethod: string(command),
+		AttrPath:   paramsPath(params),
+	})
+
+	c.metrics().RequestStarted(command)
+
+	start := time.Now()
+	res, seq, err := c.send(ctx, command, params)
+
+	c.metrics().RequestFinished(command, time.Since(start), err)
+	span.SetAttributes(map[string]interface{}{
+		AttrSeq:    seq,
+		AttrStatus: resultStatus(err),
+	})
+	span.End(err)
+
+	return res, err
+}
+
+func (c *Client) send(ctx context.Context, command Command, params interface{}) (interface{}, float64, error) {
 	c.seqlock.Lock()
 	c.seq++
 	myseq := c.seq
@@ -545,40 +1114,64 @@ func (c *Client) sendCommand(command Command, params interface{}) (interface{},
 
 	data, err := json.Marshal(params)
 	if err != nil {
-		return nil, err
+		return nil, myseq, err
 	}
 
 	msg := jsonrpc2.NewJsonRpcRequest(myseq, string(command), data)
-	rc := make(chan interface{})
+	// buffered so a response arriving after we gave up waiting never blocks the run loop.
+	rc := make(chan interface{}, 1)
 
 	defer func() {
 		c.rclock.Lock()
 		delete(c.responseChans, myseq)
 		c.rclock.Unlock()
-		close(rc)
 	}()
 
 	c.rclock.Lock()
+	if !c.connected {
+		c.rclock.Unlock()
+
+		return nil, myseq, ErrNotConnected
+	}
+
 	c.responseChans[myseq] = rc
 	c.rclock.Unlock()
 
-	err = c.client.WriteMessage(websocket.TextMessage, msg)
+	err = c.write(msg)
 	if err != nil {
-		return nil, fmt.Errorf("write message: %w", err)
+		return nil, myseq, fmt.Errorf("write message: %w", err)
 	}
 
-	r := <-rc
+	var r interface{}
+
+	select {
+	case r = <-rc:
+	case <-ctx.Done():
+		return nil, myseq, fmt.Errorf("waiting for %s: %w", command, ctx.Err())
+	}
 
 	switch v := r.(type) {
 	case error:
-		return nil, r.(error)
-	case map[string]interface{}, float64:
-		return r, nil
+		return nil, myseq, v
+	case map[string]interface{}:
+		if err := commandError(command, v); err != nil {
+			return nil, myseq, err
+		}
+
+		return r, myseq, nil
 	default:
-		return nil, fmt.Errorf("receive: %+V, %w", v, ErrUnknownResponse)
+		return r, myseq, nil
 	}
 }
 
+// write sends msg to the device.  The websocket allows only one writer at a time.
+func (c *Client) write(msg *jsonrpc2.JsonRpcMessage) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+
+	return c.client.WriteMessage(websocket.TextMessage, msg)
+}
+
 func encCreds(user string, password string) (string, error) {
 	if user == "" || password == "" {
 		return "", ErrInvalidCredentials
@@ -588,3 +1181,35 @@ func encCreds(user string, password string) (string, error) {
 
 	return credPrefix + re.Replace(base64.StdEncoding.EncodeToString([]byte(user+":"+password))), nil
 }
+
+// mapField returns field from the first element of event data, which is how most
+// events deliver their payload.
+func mapField(data []interface{}, field string) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+
+	m, ok := data[0].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	return m[field]
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true
+	case int64:
+		return x, true
+	case float64:
+		return int64(x), true
+	case string:
+		i, err := strconv.ParseInt(x, 10, 64)
+
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,295 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c0mm4nd/go-jsonrpc2"
+	"github.com/hashicorp/go-multierror"
+)
+
+// fakeRPC is an in memory connection to a device.  Frames written by the client
+// are sent on written, frames queued on read are returned by ReadMessage.
+type fakeRPC struct {
+	read    chan *jsonrpc2.JsonRpcMessage
+	written chan *jsonrpc2.JsonRpcMessage
+	once    sync.Once
+	closed  chan struct{}
+}
+
+func newFakeRPC() *fakeRPC {
+	return &fakeRPC{
+		read:    make(chan *jsonrpc2.JsonRpcMessage, 16),
+		written: make(chan *jsonrpc2.JsonRpcMessage, 16),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (f *fakeRPC) Close() error {
+	f.once.Do(func() { close(f.closed) })
+
+	return nil
+}
+
+func (f *fakeRPC) WriteMessage(_ int, msg *jsonrpc2.JsonRpcMessage) error {
+	select {
+	case f.written <- msg:
+		return nil
+	case <-f.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+func (f *fakeRPC) ReadMessage() (int, *jsonrpc2.JsonRpcMessage, error) {
+	select {
+	case msg := <-f.read:
+		return 1, msg, nil
+	case <-f.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+// serve answers every request the client writes with the result of handle till the
+// connection is closed.
+func (f *fakeRPC) serve(handle func(method string, params json.RawMessage) interface{}) {
+	go func() {
+		for {
+			select {
+			case msg := <-f.written:
+				if msg.Method == "" {
+					continue
+				}
+
+				data, _ := json.Marshal(handle(msg.Method, *msg.Params))
+				f.read <- jsonrpc2.NewJsonRpcSuccess(msg.ID, data)
+			case <-f.closed:
+				return
+			}
+		}
+	}()
+}
+
+// event sends a feedback event with the JSON document params to the client.
+func (f *fakeRPC) event(params string) {
+	f.read <- jsonrpc2.NewJsonRpcNotification("xFeedback/Event", []byte(params))
+}
+
+// newTestClient returns a client connected to a fakeRPC the same way ConnectContext
+// sets it up, without the dial.
+func newTestClient() (*Client, *fakeRPC) {
+	f := newFakeRPC()
+	c := &Client{
+		client:        f,
+		connected:     true,
+		callbacks:     make(map[Path]map[uint64]*subscription),
+		dialogSlot:    make(chan struct{}, 1),
+		dialogGone:    make(chan struct{}),
+		dialogs:       make(map[*dialog]func(error)),
+		messages:      make(map[Command]*Message),
+		responseChans: make(map[float64]chan interface{}),
+	}
+
+	return c, f
+}
+
+func TestDisconnectFailsPendingRequests(t *testing.T) {
+	c, f := newTestClient()
+
+	runErr := make(chan error, 1)
+
+	go func() { runErr <- c.Run() }()
+
+	getErr := make(chan error, 1)
+
+	go func() {
+		_, err := c.Get(StatusAudioVolumeLevel)
+		getErr <- err
+	}()
+
+	<-f.written
+	f.Close()
+
+	select {
+	case err := <-getErr:
+		if !errors.Is(err, ErrDisconnected) {
+			t.Fatalf("Get returned %v, want ErrDisconnected", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get still waiting after the connection was lost")
+	}
+
+	if err := <-runErr; err == nil {
+		t.Fatal("Run returned nil after the connection was lost")
+	}
+
+	if _, err := c.Get(StatusAudioVolumeLevel); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("Get after disconnect returned %v, want ErrNotConnected", err)
+	}
+}
+
+func TestSubscribeBeforeConnect(t *testing.T) {
+	c := &Client{}
+
+	if _, err := c.Subscribe(EventShutdown, func([]interface{}) {}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Subscribe returned %v, want ErrNotConnected", err)
+	}
+
+	if _, err := c.Alert("title", "text", 0); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Alert returned %v, want ErrNotConnected", err)
+	}
+
+	if err := NewWidgets(c).Start(); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Widgets.Start returned %v, want ErrNotConnected", err)
+	}
+
+	s, err := NewStatusCache(c, "Status Audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Start(); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("StatusCache.Start returned %v, want ErrNotConnected", err)
+	}
+}
+
+func TestSubscribeSharesFailedSubscribe(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	go func() { _ = c.Run() }()
+
+	first := make(chan error, 1)
+
+	go func() {
+		_, err := c.Subscribe(EventShutdown, func([]interface{}) {})
+		first <- err
+	}()
+
+	req := <-f.written
+
+	second := make(chan error, 1)
+
+	go func() {
+		_, err := c.Subscribe(EventShutdown, func([]interface{}) {})
+		second <- err
+	}()
+
+	// let the second subscriber join while the first subscribe is in flight.
+	time.Sleep(20 * time.Millisecond)
+
+	select {
+	case err := <-second:
+		t.Fatalf("second Subscribe returned %v before the device answered", err)
+	default:
+	}
+
+	f.read <- jsonrpc2.NewJsonRpcError(req.ID, &jsonrpc2.Error{Code: codeInvalidPath, Message: "No match"})
+
+	for name, ch := range map[string]chan error{"first": first, "second": second} {
+		select {
+		case err := <-ch:
+			if !errors.Is(err, ErrPathNotFound) {
+				t.Errorf("%s Subscribe returned %v, want ErrPathNotFound", name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s Subscribe still waiting", name)
+		}
+	}
+
+	c.cblock.Lock()
+	defer c.cblock.Unlock()
+
+	if len(c.callbacks) != 0 || len(c.subscribes) != 0 {
+		t.Errorf("failed subscribe left %v %v", c.callbacks, c.subscribes)
+	}
+}
+
+func TestGetManyPartialFailure(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	values := map[string]interface{}{
+		"Status/Audio/Volume":  float64(50),
+		"Status/Standby/State": "Off",
+	}
+
+	go func() {
+		for {
+			select {
+			case msg := <-f.written:
+				var p struct{ Path []string }
+				_ = json.Unmarshal(*msg.Params, &p)
+
+				v, ok := values[strings.Join(p.Path, "/")]
+				if !ok {
+					f.read <- jsonrpc2.NewJsonRpcError(msg.ID, &jsonrpc2.Error{Code: codeInvalidPath, Message: "No match"})
+
+					continue
+				}
+
+				data, _ := json.Marshal(v)
+				f.read <- jsonrpc2.NewJsonRpcSuccess(msg.ID, data)
+			case <-f.closed:
+				return
+			}
+		}
+	}()
+
+	go func() { _ = c.Run() }()
+
+	res, err := c.GetManyContext(context.Background(),
+		"Status Audio Volume", "Status Standby State", "Status Missing One", "Status Missing Two")
+
+	if want := map[Path]interface{}{
+		"Status Audio Volume":  float64(50),
+		"Status Standby State": "Off",
+	}; !reflect.DeepEqual(res, want) {
+		t.Errorf("GetMany returned %v, want %v", res, want)
+	}
+
+	var merr *multierror.Error
+	if !errors.As(err, &merr) || len(merr.Errors) != 2 {
+		t.Fatalf("GetMany returned %v, want two errors", err)
+	}
+
+	failed := map[string]bool{}
+
+	for _, e := range merr.Errors {
+		if !errors.Is(e, ErrPathNotFound) {
+			t.Errorf("%v does not wrap ErrPathNotFound", e)
+		}
+
+		for _, p := range []string{"Status Missing One", "Status Missing Two"} {
+			if strings.Contains(e.Error(), p) {
+				failed[p] = true
+			}
+		}
+	}
+
+	if len(failed) != 2 {
+		t.Errorf("errors %v do not name both failed paths", merr.Errors)
+	}
+}
+
+func TestGetManyNoPaths(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	res, err := c.GetManyContext(context.Background())
+	if err != nil || res == nil || len(res) != 0 {
+		t.Fatalf("GetMany() returned %v, %v, want an empty map", res, err)
+	}
+
+	select {
+	case msg := <-f.written:
+		t.Fatalf("GetMany() sent %s", msg.Method)
+	default:
+	}
+}
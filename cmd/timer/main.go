@@ -22,41 +22,45 @@ type config struct {
 	Password    string        `yaml:"password,omitempty"`
 	Insecure    bool          `yaml:"insecure,omitempty"`
 	Reconnect   bool          `yaml:"reconnect,omitempty"`
+	Debug       bool          `yaml:"debug,omitempty"`
 	TimeLine    []timeline    `yaml:"timeLine,omitempty"`
 	DisplayTime time.Duration `yaml:"displayTime"`
 }
 
 func main() {
+	startup := xapi.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), false)
+
 	data, err := ioutil.ReadFile("config.yaml")
 	if err != nil {
-		log.Printf("could not read config file: %v", err)
+		startup.Error("could not read config file", "error", err)
 		os.Exit(1)
 	}
 
 	cfg := config{}
 
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		log.Printf("could not parse config file: %v", err)
+		startup.Error("could not parse config file", "error", err)
 		os.Exit(1)
 	}
 
+	logger := xapi.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), cfg.Debug)
+
 	client := &xapi.Client{
 		URL:      cfg.URL,
 		User:     cfg.User,
 		Password: cfg.Password,
 		Insecure: cfg.Insecure,
+		Logger:   logger,
 	}
 
 	client.OnConnectFunc = func(c *xapi.Client) {
-		log.Printf("connected to: %s", cfg.URL)
-
 		for _, v := range cfg.TimeLine {
-			log.Printf("sleeping for: %v", v.Pause)
+			logger.Debug("sleeping", "pause", v.Pause)
 			time.Sleep(v.Pause)
-			log.Printf("Sending Message: %v", v.Message)
+			logger.Info("sending message", "title", v.Title, "message", v.Message)
 
-			if err := c.Alert(v.Title, v.Message, cfg.DisplayTime); err != nil {
-				log.Printf("alert error: %v", err)
+			if _, err := c.Alert(v.Title, v.Message, cfg.DisplayTime); err != nil {
+				logger.Error("alert failed", "error", err)
 			}
 		}
 
@@ -64,7 +68,7 @@ func main() {
 	}
 
 	if err := client.ConnectAndRun(); err != nil {
-		log.Printf("connect error: %v", err)
+		logger.Error("connect failed", "url", cfg.URL, "error", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jayaras/xapi"
+	"gopkg.in/yaml.v2"
+)
+
+const heartbeatPath xapi.Path = "Status SystemUnit Uptime"
+
+type config struct {
+	URL            string        `yaml:"url,omitempty"`
+	User           string        `yaml:"user,omitempty"`
+	Password       string        `yaml:"password,omitempty"`
+	Insecure       bool          `yaml:"insecure,omitempty"`
+	Debug          bool          `yaml:"debug,omitempty"`
+	Device         string        `yaml:"device,omitempty"`
+	Listen         string        `yaml:"listen,omitempty"`
+	Heartbeat      time.Duration `yaml:"heartbeat,omitempty"`
+	ReconnectDelay time.Duration `yaml:"reconnectDelay,omitempty"`
+	Subscribe      []xapi.Path   `yaml:"subscribe,omitempty"`
+}
+
+func main() {
+	data, err := ioutil.ReadFile("config.yaml")
+	if err != nil {
+		log.Printf("could not read config file: %v", err)
+		os.Exit(1)
+	}
+
+	cfg := config{
+		Device:         "codec",
+		Listen:         ":9742",
+		Heartbeat:      30 * time.Second,
+		ReconnectDelay: 10 * time.Second,
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		log.Printf("could not parse config file: %v", err)
+		os.Exit(1)
+	}
+
+	metrics := newCollector(cfg.Device)
+
+	client := &xapi.Client{
+		URL:      cfg.URL,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Insecure: cfg.Insecure,
+		Logger:   xapi.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), cfg.Debug),
+		Metrics:  metrics,
+	}
+
+	client.OnConnectFunc = func(c *xapi.Client) {
+		for _, v := range cfg.Subscribe {
+			if _, err := c.Subscribe(v, func([]interface{}) {}); err != nil {
+				log.Printf("subscribe %s: %v", v, err)
+			}
+		}
+	}
+
+	go heartbeat(client, cfg.Heartbeat)
+
+	go func() {
+		http.Handle("/metrics", metrics)
+		log.Printf("serving metrics on %s", cfg.Listen)
+
+		if err := http.ListenAndServe(cfg.Listen, nil); err != nil {
+			log.Printf("metrics server: %v", err)
+			os.Exit(1)
+		}
+	}()
+
+	for {
+		if err := client.ConnectAndRun(); err != nil {
+			log.Printf("connection error: %v", err)
+		}
+
+		time.Sleep(cfg.ReconnectDelay)
+	}
+}
+
+// heartbeat polls a cheap status value so request latency is measured even when
+// the device is idle.  Each request gives up before the next tick so a device that
+// stopped answering can't pile up requests.
+func heartbeat(c *xapi.Client, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	timeout := interval * 3 / 4
+
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+		if _, err := c.GetContext(ctx, heartbeatPath); err != nil {
+			log.Printf("heartbeat: %v", err)
+		}
+
+		cancel()
+	}
+}
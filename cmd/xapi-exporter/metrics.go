@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jayaras/xapi"
+)
+
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range latencyBuckets {
+		if v <= b {
+			h.buckets[i]++
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+// collector implements xapi.Metrics and renders the Prometheus text format.
+type collector struct {
+	lock          sync.Mutex
+	device        string
+	latency       map[xapi.Command]*histogram
+	requestErrors map[xapi.Command]uint64
+	inFlight      int
+	subscriptions int
+	events        map[xapi.Path]uint64
+	dropped       map[string]uint64
+	reconnects    uint64
+	connected     bool
+	lastEvent     time.Time
+}
+
+func newCollector(device string) *collector {
+	return &collector{
+		device:        device,
+		latency:       make(map[xapi.Command]*histogram),
+		requestErrors: make(map[xapi.Command]uint64),
+		events:        make(map[xapi.Path]uint64),
+		dropped:       make(map[string]uint64),
+	}
+}
+
+func (c *collector) RequestStarted(xapi.Command) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.inFlight++
+}
+
+func (c *collector) RequestFinished(command xapi.Command, latency time.Duration, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.inFlight--
+
+	h, ok := c.latency[command]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		c.latency[command] = h
+	}
+
+	h.observe(latency.Seconds())
+
+	if err != nil {
+		c.requestErrors[command]++
+	}
+}
+
+func (c *collector) SubscriptionsChanged(count int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.subscriptions = count
+}
+
+func (c *collector) EventReceived(path xapi.Path) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.events[path]++
+	c.lastEvent = time.Now()
+}
+
+func (c *collector) EventDropped(reason error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dropped[reason.Error()]++
+}
+
+func (c *collector) Connected(reconnect bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.connected = true
+
+	if reconnect {
+		c.reconnects++
+	}
+}
+
+func (c *collector) Disconnected() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.connected = false
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.write(w)
+}
+
+func (c *collector) write(w io.Writer) {
+	dev := fmt.Sprintf("device=%q", escape(c.device))
+
+	header(w, "xapi_request_duration_seconds", "histogram", "Latency of commands sent to the device.")
+
+	for _, k := range sortedCommands(c.latency) {
+		h := c.latency[k]
+		labels := fmt.Sprintf("%s,command=%q", dev, escape(string(k)))
+
+		for i, b := range latencyBuckets {
+			fmt.Fprintf(w, "xapi_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, b, h.buckets[i])
+		}
+
+		fmt.Fprintf(w, "xapi_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "xapi_request_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(w, "xapi_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	header(w, "xapi_request_errors_total", "counter", "Commands that returned an error.")
+
+	for _, k := range sortedCommands(c.latency) {
+		fmt.Fprintf(w, "xapi_request_errors_total{%s,command=%q} %d\n", dev, escape(string(k)), c.requestErrors[k])
+	}
+
+	header(w, "xapi_requests_in_flight", "gauge", "Commands waiting for a response.")
+	fmt.Fprintf(w, "xapi_requests_in_flight{%s} %d\n", dev, c.inFlight)
+
+	header(w, "xapi_subscriptions", "gauge", "Subscribed paths.")
+	fmt.Fprintf(w, "xapi_subscriptions{%s} %d\n", dev, c.subscriptions)
+
+	header(w, "xapi_events_received_total", "counter", "Events delivered per subscribed path.")
+
+	paths := make([]string, 0, len(c.events))
+	for k := range c.events {
+		paths = append(paths, string(k))
+	}
+
+	sort.Strings(paths)
+
+	for _, k := range paths {
+		fmt.Fprintf(w, "xapi_events_received_total{%s,path=%q} %d\n", dev, escape(k), c.events[xapi.Path(k)])
+	}
+
+	header(w, "xapi_events_dropped_total", "counter", "Events that could not be routed to a subscriber.")
+
+	reasons := make([]string, 0, len(c.dropped))
+	for k := range c.dropped {
+		reasons = append(reasons, k)
+	}
+
+	sort.Strings(reasons)
+
+	for _, k := range reasons {
+		fmt.Fprintf(w, "xapi_events_dropped_total{%s,reason=%q} %d\n", dev, escape(k), c.dropped[k])
+	}
+
+	header(w, "xapi_last_event_timestamp_seconds", "gauge", "Unix time of the last event received.")
+
+	last := 0.0
+	if !c.lastEvent.IsZero() {
+		last = float64(c.lastEvent.UnixNano()) / float64(time.Second)
+	}
+
+	fmt.Fprintf(w, "xapi_last_event_timestamp_seconds{%s} %g\n", dev, last)
+
+	header(w, "xapi_reconnects_total", "counter", "Reconnects to the device.")
+	fmt.Fprintf(w, "xapi_reconnects_total{%s} %d\n", dev, c.reconnects)
+
+	connected := 0
+	if c.connected {
+		connected = 1
+	}
+
+	header(w, "xapi_connected", "gauge", "1 when connected to the device.")
+	fmt.Fprintf(w, "xapi_connected{%s} %d\n", dev, connected)
+}
+
+func header(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedCommands(m map[xapi.Command]*histogram) []xapi.Command {
+	res := make([]xapi.Command, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+
+	return res
+}
+
+// escape prepares a label value for %q, which already escapes quotes, backslashes
+// and newlines the way the text format expects.  Anything %q would render as a Go
+// specific escape is replaced.
+func escape(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\n' {
+			return ' '
+		}
+
+		return r
+	}, s)
+}
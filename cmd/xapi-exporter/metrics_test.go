@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jayaras/xapi"
+)
+
+func TestCollectorWrite(t *testing.T) {
+	c := newCollector("room \"1\"\\a")
+
+	const command xapi.Command = "xCommand/Audio/Volume/Set"
+
+	for _, v := range []time.Duration{3 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond, time.Minute} {
+		c.RequestStarted(command)
+		c.RequestFinished(command, v, nil)
+	}
+
+	c.EventDropped(errors.New("queue\tfull"))
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	out := buf.String()
+
+	labels := `device="room \"1\"\\a",command="xCommand/Audio/Volume/Set"`
+
+	for _, want := range []string{
+		// buckets are cumulative, +Inf counts the minute that is in no bucket.
+		`xapi_request_duration_seconds_bucket{` + labels + `,le="0.005"} 1`,
+		`xapi_request_duration_seconds_bucket{` + labels + `,le="0.01"} 1`,
+		`xapi_request_duration_seconds_bucket{` + labels + `,le="0.025"} 3`,
+		`xapi_request_duration_seconds_bucket{` + labels + `,le="10"} 3`,
+		`xapi_request_duration_seconds_bucket{` + labels + `,le="+Inf"} 4`,
+		`xapi_request_duration_seconds_count{` + labels + `} 4`,
+		`xapi_events_dropped_total{device="room \"1\"\\a",reason="queue full"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %s in\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogramCumulative(t *testing.T) {
+	h := &histogram{buckets: make([]uint64, len(latencyBuckets))}
+
+	for _, v := range []float64{.001, .07, .3, 4, 60} {
+		h.observe(v)
+	}
+
+	for i := 1; i < len(h.buckets); i++ {
+		if h.buckets[i] < h.buckets[i-1] {
+			t.Fatalf("bucket %g has %d, less than the %d below it", latencyBuckets[i], h.buckets[i], h.buckets[i-1])
+		}
+	}
+
+	if last := h.buckets[len(h.buckets)-1]; last != 4 || h.count != 5 {
+		t.Fatalf("largest bucket %d and count %d, want 4 and 5", last, h.count)
+	}
+}
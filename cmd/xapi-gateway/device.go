@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jayaras/xapi"
+)
+
+// streamBuffer is how many events a slow event stream client can fall behind before
+// events are dropped for it.
+const streamBuffer = 64
+
+type event struct {
+	Path xapi.Path     `json:"path"`
+	Data []interface{} `json:"data"`
+}
+
+// device holds the persistent connection to one codec and fans its events out to the
+// connected event stream clients.
+type device struct {
+	id        string
+	client    *xapi.Client
+	events    []xapi.Path
+	lock      sync.Mutex
+	connected bool
+	streams   map[chan event]string
+}
+
+func newDevice(id string, client *xapi.Client, events []xapi.Path) *device {
+	d := &device{
+		id:      id,
+		client:  client,
+		events:  events,
+		streams: make(map[chan event]string),
+	}
+
+	client.OnConnectFunc = d.onConnect
+
+	return d
+}
+
+// run keeps the device connected, reconnecting after delay.
+func (d *device) run(delay time.Duration) {
+	for {
+		if err := d.client.ConnectAndRun(); err != nil {
+			log.Printf("device %s: %v", d.id, err)
+		}
+
+		d.setConnected(false)
+		time.Sleep(delay)
+	}
+}
+
+func (d *device) onConnect(c *xapi.Client) {
+	for _, v := range d.events {
+		path := v
+
+		if _, err := c.Subscribe(path, func(data []interface{}) {
+			d.broadcast(event{Path: path, Data: data})
+		}); err != nil {
+			log.Printf("device %s: subscribe %s: %v", d.id, path, err)
+		}
+	}
+
+	d.setConnected(true)
+}
+
+func (d *device) setConnected(connected bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.connected = connected
+}
+
+func (d *device) isConnected() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.connected
+}
+
+// underPath reports if p is path or one of its children.
+func underPath(p, path xapi.Path) bool {
+	return p == path || strings.HasPrefix(string(p), string(path)+" ")
+}
+
+// checkPrefix reports if the events under prefix can be streamed.  Events only carry
+// the subscribed path they were delivered for, so prefix has to cover whole
+// subscriptions: at least one subscribed path has to be under it and none of them
+// can be above it.
+func (d *device) checkPrefix(prefix xapi.Path) error {
+	found := false
+
+	for _, v := range d.events {
+		if underPath(v, prefix) {
+			found = true
+		} else if underPath(prefix, v) {
+			return fmt.Errorf("path %s is inside subscribed path %s, filter on %s instead", prefix, v, v)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no subscribed path under %s", prefix)
+	}
+
+	return nil
+}
+
+// stream registers a client for the events under prefix, or all events when empty.
+// The returned func unregisters it.
+func (d *device) stream(prefix xapi.Path) (<-chan event, func()) {
+	ch := make(chan event, streamBuffer)
+
+	d.lock.Lock()
+	d.streams[ch] = string(prefix)
+	d.lock.Unlock()
+
+	return ch, func() {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		delete(d.streams, ch)
+	}
+}
+
+func (d *device) broadcast(ev event) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for ch, prefix := range d.streams {
+		if prefix != "" && !underPath(ev.Path, xapi.Path(prefix)) {
+			continue
+		}
+
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("device %s: event stream is behind, dropping %s", d.id, ev.Path)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jayaras/xapi"
+)
+
+func TestCheckPrefix(t *testing.T) {
+	d := &device{events: []xapi.Path{
+		"Event UserInterface Extensions Widget Action",
+		"Event UserInterface Message Prompt Response",
+		"Event CallDisconnect",
+	}}
+
+	tests := []struct {
+		prefix xapi.Path
+		ok     bool
+	}{
+		{"Event", true},
+		{"Event UserInterface", true},
+		{"Event UserInterface Message Prompt Response", true},
+		{"Event UserInterface Message Prompt Response OptionId", false},
+		{"Event CallDisconnect CauseType", false},
+		{"Event UserInterface Ext", false},
+		{"Status", false},
+	}
+
+	for _, tt := range tests {
+		if err := d.checkPrefix(tt.prefix); (err == nil) != tt.ok {
+			t.Errorf("checkPrefix(%q) = %v, want ok %v", tt.prefix, err, tt.ok)
+		}
+	}
+}
+
+func TestBroadcastFiltersOnPrefix(t *testing.T) {
+	d := &device{streams: make(map[chan event]string)}
+
+	all, _ := d.stream("")
+	ui, _ := d.stream("Event UserInterface")
+
+	d.broadcast(event{Path: "Event UserInterface Extensions Widget Action"})
+	d.broadcast(event{Path: "Event CallDisconnect"})
+
+	if len(all) != 2 {
+		t.Errorf("unfiltered stream got %d events, want 2", len(all))
+	}
+
+	if len(ui) != 1 {
+		t.Errorf("filtered stream got %d events, want 1", len(ui))
+	}
+}
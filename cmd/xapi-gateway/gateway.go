@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jayaras/xapi"
+)
+
+const (
+	apiKeyHeader  = "X-API-Key"
+	bearerPrefix  = "Bearer "
+	keepAlive     = 30 * time.Second
+	maxBody       = 1 << 20
+	statusRoot    = "Status"
+	routeAlert    = "alert"
+	routeStatus   = "status"
+	routeCommand  = "command"
+	routeEvents   = "events"
+	routeDevices  = "devices"
+	contentJSON   = "application/json"
+	contentStream = "text/event-stream"
+)
+
+type alertRequest struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	// Duration in seconds, zero keeps the alert up till it is dismissed.
+	Duration float64 `json:"duration"`
+}
+
+type deviceInfo struct {
+	ID        string `json:"id"`
+	Connected bool   `json:"connected"`
+}
+
+// gateway serves the device API over HTTP:
+//
+//	GET  /devices
+//	POST /devices/{id}/alert
+//	GET  /devices/{id}/status/{path...}
+//	POST /devices/{id}/command/{command...}
+//	GET  /devices/{id}/events?path={path}
+type gateway struct {
+	devices map[string]*device
+	keys    [][]byte
+}
+
+func newGateway(devices map[string]*device, keys []string) *gateway {
+	g := &gateway{devices: devices}
+
+	for _, v := range keys {
+		g.keys = append(g.keys, []byte(v))
+	}
+
+	return g
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !g.authorized(r) {
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid api key"))
+
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != routeDevices {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if len(parts) == 1 {
+		g.list(w, r)
+
+		return
+	}
+
+	d, ok := g.devices[parts[1]]
+	if !ok || len(parts) < 3 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown device %q", parts[1]))
+
+		return
+	}
+
+	rest := parts[3:]
+
+	switch {
+	case parts[2] == routeAlert && len(rest) == 0:
+		g.alert(w, r, d)
+	case parts[2] == routeStatus:
+		g.status(w, r, d, rest)
+	case parts[2] == routeCommand && len(rest) > 0:
+		g.command(w, r, d, rest)
+	case parts[2] == routeEvents && len(rest) == 0:
+		g.events(w, r, d)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorized checks the key from the X-API-Key header or a bearer token.
+func (g *gateway) authorized(r *http.Request) bool {
+	key := r.Header.Get(apiKeyHeader)
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, bearerPrefix) {
+		key = strings.TrimPrefix(auth, bearerPrefix)
+	}
+
+	if key == "" {
+		return false
+	}
+
+	for _, v := range g.keys {
+		if subtle.ConstantTimeCompare(v, []byte(key)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *gateway) list(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	res := make([]deviceInfo, 0, len(g.devices))
+	for id, d := range g.devices {
+		res = append(res, deviceInfo{ID: id, Connected: d.isConnected()})
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (g *gateway) alert(w http.ResponseWriter, r *http.Request, d *device) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req alertRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	// the handle is dropped on purpose.  It finishes and drops its subscription when
+	// the alert times out, is dismissed or is replaced by the next one, so at most
+	// one is ever outstanding.
+	_, err := d.client.AlertContext(r.Context(), req.Title, req.Text, time.Duration(req.Duration*float64(time.Second)))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *gateway) status(w http.ResponseWriter, r *http.Request, d *device, rest []string) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	path, err := xapi.ParsePath(strings.Join(append([]string{statusRoot}, rest...), "/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	v, err := d.client.GetContext(r.Context(), path)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, v)
+}
+
+// command runs the command named by the path with the JSON object body as its
+// parameters.
+func (g *gateway) command(w http.ResponseWriter, r *http.Request, d *device, rest []string) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var params map[string]interface{}
+	if r.ContentLength != 0 {
+		if err := readJSON(r, &params); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+
+			return
+		}
+	}
+
+	res, err := d.client.ExecuteContext(r.Context(), xapi.NewCommand(rest...), params)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// events streams the device events as Server-Sent Events.  The path query parameter
+// limits the stream to the subscribed paths under it.
+func (g *gateway) events(w http.ResponseWriter, r *http.Request, d *device) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+
+		return
+	}
+
+	var prefix xapi.Path
+
+	if p := r.URL.Query().Get("path"); p != "" {
+		var err error
+
+		if prefix, err = xapi.ParsePath(p); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		if err := d.checkPrefix(prefix); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+
+			return
+		}
+	}
+
+	ch, cancel := d.stream(prefix)
+	defer cancel()
+
+	w.Header().Set("Content-Type", contentStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev := <-ch:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("event %s: %v", ev.Path, err)
+
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", strings.ReplaceAll(string(ev.Path), " ", "/"), data)
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+
+	return false
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBody))
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", contentJSON)
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// errorStatus maps the client errors to HTTP status codes.
+func errorStatus(err error) int {
+	var cmdErr *xapi.CommandError
+
+	switch {
+	case errors.Is(err, xapi.ErrNotConnected):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, xapi.ErrPathNotFound), errors.Is(err, xapi.ErrMethodNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, xapi.ErrInvalidPath), errors.Is(err, xapi.ErrInvalidParams):
+		return http.StatusBadRequest
+	case errors.As(err, &cmdErr), errors.Is(err, xapi.ErrCommandFailed):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
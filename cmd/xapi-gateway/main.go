@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jayaras/xapi"
+	"gopkg.in/yaml.v2"
+)
+
+type deviceConfig struct {
+	URL      string `yaml:"url,omitempty"`
+	User     string `yaml:"user,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty"`
+}
+
+type config struct {
+	Listen         string                  `yaml:"listen,omitempty"`
+	APIKeys        []string                `yaml:"apiKeys,omitempty"`
+	Debug          bool                    `yaml:"debug,omitempty"`
+	ReconnectDelay time.Duration           `yaml:"reconnectDelay,omitempty"`
+	Devices        map[string]deviceConfig `yaml:"devices,omitempty"`
+	// Events are subscribed on every device and streamed to event stream clients.
+	Events []xapi.Path `yaml:"events,omitempty"`
+}
+
+func main() {
+	data, err := ioutil.ReadFile("config.yaml")
+	if err != nil {
+		log.Printf("could not read config file: %v", err)
+		os.Exit(1)
+	}
+
+	cfg := config{
+		Listen:         ":8080",
+		ReconnectDelay: 10 * time.Second,
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		log.Printf("could not parse config file: %v", err)
+		os.Exit(1)
+	}
+
+	if len(cfg.APIKeys) == 0 {
+		log.Printf("at least one api key is required")
+		os.Exit(1)
+	}
+
+	logger := xapi.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), cfg.Debug)
+	devices := make(map[string]*device, len(cfg.Devices))
+
+	for id, v := range cfg.Devices {
+		d := newDevice(id, &xapi.Client{
+			URL:      v.URL,
+			User:     v.User,
+			Password: v.Password,
+			Insecure: v.Insecure,
+			Logger:   logger,
+			// events reach the gateway clients in the order the device sent them.
+			Dispatch: xapi.DispatchSerial,
+		}, cfg.Events)
+
+		devices[id] = d
+
+		go d.run(cfg.ReconnectDelay)
+	}
+
+	log.Printf("serving gateway on %s", cfg.Listen)
+
+	if err := http.ListenAndServe(cfg.Listen, newGateway(devices, cfg.APIKeys)); err != nil {
+		log.Printf("gateway server: %v", err)
+		os.Exit(1)
+	}
+}
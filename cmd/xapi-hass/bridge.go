@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jayaras/xapi"
+)
+
+const (
+	widgetToggle      = "toggle"
+	widgetSlider      = "slider"
+	widgetButton      = "button"
+	widgetGroupButton = "groupbutton"
+	stateOn           = "on"
+)
+
+// bridge keeps UI Extension widgets and Home Assistant entities in sync and publishes
+// device status as Home Assistant sensors.
+type bridge struct {
+	cfg     config
+	hass    *hass
+	widgets *xapi.Widgets
+	// sliders are throttled so dragging one does not flood Home Assistant with calls.
+	sliders *xapi.Widgets
+	lock    sync.Mutex
+	states  map[string]entityState
+}
+
+func newBridge(cfg config, client *xapi.Client, h *hass) (*bridge, error) {
+	b := &bridge{
+		cfg:     cfg,
+		hass:    h,
+		widgets: xapi.NewWidgets(client),
+		sliders: xapi.NewWidgets(client, xapi.WithThrottle(cfg.SliderThrottle)),
+		states:  make(map[string]entityState),
+	}
+
+	onError := func(err error) {
+		log.Printf("widgets: %v", err)
+	}
+
+	b.widgets.OnError = onError
+	b.sliders.OnError = onError
+
+	h.onState = b.stateChanged
+	h.onReady = b.loadStates
+
+	for _, w := range cfg.Widgets {
+		if err := b.bind(w); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range cfg.Sensors {
+		if err := b.publish(client, s); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// loadStates reads the current state of every mapped entity, used after
+// (re)connecting to Home Assistant.
+func (b *bridge) loadStates() {
+	for _, w := range b.cfg.Widgets {
+		if w.Type == widgetButton {
+			continue
+		}
+
+		st, err := b.hass.state(w.Entity)
+		if err != nil {
+			log.Printf("state of %s: %v", w.Entity, err)
+
+			continue
+		}
+
+		b.stateChanged(st)
+	}
+}
+
+func (b *bridge) stateChanged(st entityState) {
+	b.lock.Lock()
+	b.states[st.EntityID] = st
+	b.lock.Unlock()
+
+	for _, w := range b.cfg.Widgets {
+		if w.Entity != st.EntityID || w.Type == widgetButton {
+			continue
+		}
+
+		if err := b.widgetsFor(w).Update(w.Widget); err != nil {
+			log.Printf("update widget %s: %v", w.Widget, err)
+		}
+	}
+}
+
+func (b *bridge) state(entity string) entityState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.states[entity]
+}
+
+func (b *bridge) call(w widgetMapping, service string, data map[string]interface{}) {
+	for k, v := range w.Data {
+		data[k] = v
+	}
+
+	if err := b.hass.callService(service, w.Entity, data); err != nil {
+		log.Printf("widget %s: %v", w.Widget, err)
+	}
+}
+
+func (b *bridge) widgetsFor(w widgetMapping) *xapi.Widgets {
+	if w.Type == widgetSlider {
+		return b.sliders
+	}
+
+	return b.widgets
+}
+
+func (b *bridge) bind(w widgetMapping) error {
+	domain := strings.SplitN(w.Entity, ".", 2)[0]
+
+	switch w.Type {
+	case widgetToggle:
+		b.widgets.BindToggle(w.Widget, func() bool {
+			return b.state(w.Entity).State == stateOn
+		}, func(on bool) {
+			service := domain + ".turn_off"
+			if on {
+				service = domain + ".turn_on"
+			}
+
+			b.call(w, service, map[string]interface{}{})
+		})
+	case widgetSlider:
+		attr := withDefault(w.Attribute, "brightness")
+		service := withDefault(w.Service, domain+".turn_on")
+		field := withDefault(w.Field, attr)
+
+		max := w.Max
+		if max == 0 {
+			max = 255
+		}
+
+		return b.sliders.BindSlider(w.Widget, w.Min, max, func() float64 {
+			st := b.state(w.Entity)
+			v, _ := st.Attributes[attr].(float64)
+
+			return math.Max(w.Min, v)
+		}, func(v float64) {
+			b.call(w, service, map[string]interface{}{field: math.Round(v)})
+		})
+	case widgetGroupButton:
+		service := withDefault(w.Service, domain+".select_option")
+		field := withDefault(w.Field, "option")
+
+		b.widgets.BindGroupButton(w.Widget, func() string {
+			st := b.state(w.Entity)
+			if w.Attribute != "" {
+				return fmt.Sprint(st.Attributes[w.Attribute])
+			}
+
+			return st.State
+		}, func(v string) {
+			b.call(w, service, map[string]interface{}{field: v})
+		})
+	case widgetButton:
+		service := withDefault(w.Service, domain+".toggle")
+
+		b.widgets.BindButton(w.Widget, func(t xapi.WidgetEventType) {
+			if t == xapi.WidgetClicked {
+				b.call(w, service, map[string]interface{}{})
+			}
+		})
+	default:
+		return fmt.Errorf("widget %s: unknown type %q", w.Widget, w.Type)
+	}
+
+	return nil
+}
+
+// publish mirrors a status path of the device to a Home Assistant sensor.
+func (b *bridge) publish(client *xapi.Client, s sensorMapping) error {
+	cache, err := xapi.NewStatusCache(client, s.Path)
+	if err != nil {
+		return fmt.Errorf("sensor %s: %w", s.Entity, err)
+	}
+
+	cache.OnError = func(err error) {
+		log.Printf("sensor %s: %v", s.Entity, err)
+	}
+
+	attrs := map[string]interface{}{
+		"friendly_name": withDefault(s.Name, string(s.Path)),
+	}
+
+	if s.Unit != "" {
+		attrs["unit_of_measurement"] = s.Unit
+	}
+
+	_, err = cache.OnChange(s.Path, func(_, v interface{}) {
+		if err := b.hass.setState(s.Entity, sensorState(v), attrs); err != nil {
+			log.Printf("sensor %s: %v", s.Entity, err)
+		}
+	})
+
+	return err
+}
+
+func sensorState(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "unknown"
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(x)
+
+		return string(data)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func withDefault(v string, def string) string {
+	if v == "" {
+		return def
+	}
+
+	return v
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+var errAuth = errors.New("home assistant rejected the token")
+
+type entityState struct {
+	EntityID   string                 `json:"entity_id"`
+	State      string                 `json:"state"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type hassMessage struct {
+	ID    int    `json:"id,omitempty"`
+	Type  string `json:"type"`
+	Event struct {
+		EventType string `json:"event_type"`
+		Data      struct {
+			EntityID string       `json:"entity_id"`
+			NewState *entityState `json:"new_state"`
+		} `json:"data"`
+	} `json:"event"`
+}
+
+// hass talks to Home Assistant.  State changes are streamed over its WebSocket API,
+// everything else goes through the REST API.
+type hass struct {
+	url     string
+	token   string
+	http    *http.Client
+	onState func(entityState)
+	// onReady is called once state changes are subscribed to.
+	onReady func()
+}
+
+// run streams state changes to onState till the connection drops or ctx ends.
+func (h *hass) run(ctx context.Context) error {
+	// closes the connection when ctx ends, and stops watching it once run returns.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	u, err := url.Parse(h.url)
+	if err != nil {
+		return fmt.Errorf("hass url: %w", err)
+	}
+
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/websocket"
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("hass dial: %w", err)
+	}
+
+	defer conn.Close()
+
+	if err := resp.Body.Close(); err != nil {
+		return fmt.Errorf("hass dial: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var msg hassMessage
+
+	// auth_required, then auth_ok or auth_invalid once we sent the token.
+	if err := conn.ReadJSON(&msg); err != nil {
+		return fmt.Errorf("hass auth: %w", err)
+	}
+
+	if err := conn.WriteJSON(map[string]interface{}{"type": "auth", "access_token": h.token}); err != nil {
+		return fmt.Errorf("hass auth: %w", err)
+	}
+
+	if err := conn.ReadJSON(&msg); err != nil {
+		return fmt.Errorf("hass auth: %w", err)
+	}
+
+	if msg.Type != "auth_ok" {
+		return errAuth
+	}
+
+	if err := conn.WriteJSON(map[string]interface{}{
+		"id":         1,
+		"type":       "subscribe_events",
+		"event_type": "state_changed",
+	}); err != nil {
+		return fmt.Errorf("hass subscribe: %w", err)
+	}
+
+	if h.onReady != nil {
+		go h.onReady()
+	}
+
+	for {
+		msg = hassMessage{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return fmt.Errorf("hass read: %w", err)
+		}
+
+		if msg.Type == "event" && msg.Event.Data.NewState != nil {
+			h.onState(*msg.Event.Data.NewState)
+		}
+	}
+}
+
+func (h *hass) state(entity string) (entityState, error) {
+	var st entityState
+
+	err := h.do(http.MethodGet, "/api/states/"+entity, nil, &st)
+
+	return st, err
+}
+
+// callService calls a service such as light.turn_on for entity.
+func (h *hass) callService(service string, entity string, data map[string]interface{}) error {
+	parts := strings.SplitN(service, ".", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("service %q is not domain.service", service)
+	}
+
+	body := map[string]interface{}{"entity_id": entity}
+	for k, v := range data {
+		body[k] = v
+	}
+
+	return h.do(http.MethodPost, "/api/services/"+parts[0]+"/"+parts[1], body, nil)
+}
+
+// setState creates or updates an entity, used to publish device status as sensors.
+func (h *hass) setState(entity string, state string, attrs map[string]interface{}) error {
+	return h.do(http.MethodPost, "/api/states/"+entity, map[string]interface{}{
+		"state":      state,
+		"attributes": attrs,
+	}, nil)
+}
+
+func (h *hass) do(method string, path string, body interface{}, out interface{}) error {
+	var r io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(h.url, "/")+path, r)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("hass %s %s: %w", method, path, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errAuth
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+
+		return fmt.Errorf("hass %s %s: %s: %s", method, path, resp.Status, msg)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("hass %s %s: %w", method, path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testToken = "secret"
+
+// fakeHass is a local Home Assistant serving the WebSocket auth and state_changed
+// subscription plus the REST calls used by the bridge.
+type fakeHass struct {
+	*httptest.Server
+	// events are sent once the client subscribed, closing the connection after.
+	events []entityState
+	// requests gets the method, path and body of every REST call.
+	requests chan restCall
+}
+
+type restCall struct {
+	method string
+	path   string
+	body   map[string]interface{}
+}
+
+func newFakeHass(t *testing.T, events ...entityState) *fakeHass {
+	f := &fakeHass{events: events, requests: make(chan restCall, 16)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/websocket", f.websocket)
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		call := restCall{method: r.Method, path: r.URL.Path}
+		_ = json.NewDecoder(r.Body).Decode(&call.body)
+		f.requests <- call
+
+		_ = json.NewEncoder(w).Encode(entityState{EntityID: "light.desk", State: stateOn})
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeHass) websocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	var msg map[string]interface{}
+
+	_ = conn.WriteJSON(map[string]interface{}{"type": "auth_required"})
+
+	if err := conn.ReadJSON(&msg); err != nil {
+		return
+	}
+
+	if msg["access_token"] != testToken {
+		_ = conn.WriteJSON(map[string]interface{}{"type": "auth_invalid"})
+
+		return
+	}
+
+	_ = conn.WriteJSON(map[string]interface{}{"type": "auth_ok"})
+
+	if err := conn.ReadJSON(&msg); err != nil || msg["type"] != "subscribe_events" {
+		return
+	}
+
+	for _, v := range f.events {
+		v := v
+
+		_ = conn.WriteJSON(map[string]interface{}{
+			"type": "event",
+			"event": map[string]interface{}{
+				"event_type": "state_changed",
+				"data":       map[string]interface{}{"entity_id": v.EntityID, "new_state": &v},
+			},
+		})
+	}
+
+	// wait for the client to hang up.
+	_, _, _ = conn.ReadMessage()
+}
+
+func TestRunStreamsStates(t *testing.T) {
+	f := newFakeHass(t, entityState{EntityID: "light.desk", State: stateOn})
+
+	states := make(chan entityState, 1)
+	ready := make(chan struct{}, 1)
+
+	h := &hass{
+		url:     f.URL,
+		token:   testToken,
+		http:    f.Client(),
+		onState: func(st entityState) { states <- st },
+		onReady: func() { ready <- struct{}{} },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() { done <- h.run(ctx) }()
+
+	select {
+	case st := <-states:
+		if st.EntityID != "light.desk" || st.State != stateOn {
+			t.Fatalf("state %+v", st)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no state change delivered")
+	}
+
+	<-ready
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("run did not return once ctx ended")
+	}
+}
+
+func TestRunRejectedToken(t *testing.T) {
+	f := newFakeHass(t)
+	h := &hass{url: f.URL, token: "wrong", http: f.Client()}
+
+	if err := h.run(context.Background()); !errors.Is(err, errAuth) {
+		t.Fatalf("run returned %v, want errAuth", err)
+	}
+}
+
+func TestRunDoesNotLeakOnReconnect(t *testing.T) {
+	f := newFakeHass(t)
+	h := &hass{url: f.URL, token: "wrong", http: f.Client()}
+
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		_ = h.run(context.Background())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before+5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines after 20 connections, %d before", runtime.NumGoroutine(), before)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCallService(t *testing.T) {
+	f := newFakeHass(t)
+	h := &hass{url: f.URL, token: testToken, http: f.Client()}
+
+	if err := h.callService("light.turn_on", "light.desk", map[string]interface{}{"brightness": 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	call := <-f.requests
+	if call.method != http.MethodPost || call.path != "/api/services/light/turn_on" {
+		t.Fatalf("called %s %s", call.method, call.path)
+	}
+
+	if call.body["entity_id"] != "light.desk" || call.body["brightness"] != float64(10) {
+		t.Fatalf("body %v", call.body)
+	}
+
+	if err := h.callService("turn_on", "light.desk", nil); err == nil {
+		t.Fatal("service without a domain accepted")
+	}
+}
+
+func TestState(t *testing.T) {
+	f := newFakeHass(t)
+	h := &hass{url: f.URL, token: testToken, http: f.Client()}
+
+	st, err := h.state("light.desk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if call := <-f.requests; call.method != http.MethodGet || call.path != "/api/states/light.desk" {
+		t.Fatalf("called %s %s", call.method, call.path)
+	}
+
+	if st.State != stateOn {
+		t.Fatalf("state %+v", st)
+	}
+
+	h.token = "wrong"
+
+	if _, err := h.state("light.desk"); !errors.Is(err, errAuth) {
+		t.Fatalf("state with a bad token returned %v, want errAuth", err)
+	}
+}
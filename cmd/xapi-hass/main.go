@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jayaras/xapi"
+	"gopkg.in/yaml.v2"
+)
+
+type hassConfig struct {
+	URL   string `yaml:"url,omitempty"`
+	Token string `yaml:"token,omitempty"`
+}
+
+// widgetMapping maps a UI Extension widget to a Home Assistant entity.
+type widgetMapping struct {
+	Widget string `yaml:"widget"`
+	Entity string `yaml:"entity"`
+	// Type is one of toggle, slider, groupbutton or button.
+	Type string `yaml:"type"`
+	// Service overrides the service called on a widget action, as domain.service.
+	Service string `yaml:"service,omitempty"`
+	// Attribute of the entity shown on sliders and group buttons.
+	Attribute string `yaml:"attribute,omitempty"`
+	// Field of the service data the widget value is sent in.
+	Field string `yaml:"field,omitempty"`
+	// Min and Max are the range of slider values.
+	Min float64 `yaml:"min,omitempty"`
+	Max float64 `yaml:"max,omitempty"`
+	// Data is extra service data sent with every call.
+	Data map[string]interface{} `yaml:"data,omitempty"`
+}
+
+// sensorMapping publishes a device status path as a Home Assistant sensor.
+type sensorMapping struct {
+	Path   xapi.Path `yaml:"path"`
+	Entity string    `yaml:"entity"`
+	Name   string    `yaml:"name,omitempty"`
+	Unit   string    `yaml:"unit,omitempty"`
+}
+
+type config struct {
+	URL            string          `yaml:"url,omitempty"`
+	User           string          `yaml:"user,omitempty"`
+	Password       string          `yaml:"password,omitempty"`
+	Insecure       bool            `yaml:"insecure,omitempty"`
+	Debug          bool            `yaml:"debug,omitempty"`
+	ReconnectDelay time.Duration   `yaml:"reconnectDelay,omitempty"`
+	SliderThrottle time.Duration   `yaml:"sliderThrottle,omitempty"`
+	Hass           hassConfig      `yaml:"hass"`
+	Widgets        []widgetMapping `yaml:"widgets,omitempty"`
+	Sensors        []sensorMapping `yaml:"sensors,omitempty"`
+}
+
+func main() {
+	data, err := ioutil.ReadFile("config.yaml")
+	if err != nil {
+		log.Printf("could not read config file: %v", err)
+		os.Exit(1)
+	}
+
+	cfg := config{
+		ReconnectDelay: 10 * time.Second,
+		SliderThrottle: 250 * time.Millisecond,
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		log.Printf("could not parse config file: %v", err)
+		os.Exit(1)
+	}
+
+	client := &xapi.Client{
+		URL:      cfg.URL,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Insecure: cfg.Insecure,
+		Logger:   xapi.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), cfg.Debug),
+		Dispatch: xapi.DispatchSerial,
+	}
+
+	h := &hass{
+		url:   cfg.Hass.URL,
+		token: cfg.Hass.Token,
+		http:  &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if _, err := newBridge(cfg, client, h); err != nil {
+		log.Printf("config error: %v", err)
+		os.Exit(1)
+	}
+
+	go func() {
+		for {
+			err := h.run(context.Background())
+			log.Printf("home assistant connection: %v", err)
+
+			if err == errAuth {
+				os.Exit(1)
+			}
+
+			time.Sleep(cfg.ReconnectDelay)
+		}
+	}()
+
+	for {
+		if err := client.ConnectAndRun(); err != nil {
+			log.Printf("device connection: %v", err)
+		}
+
+		time.Sleep(cfg.ReconnectDelay)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jayaras/xapi"
+)
+
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+	topicSet       = "set"
+	topicCommand   = "command"
+	topicResult    = "result"
+	topicAvailable = "availability"
+	configRoot     = "Configuration"
+	qosAtLeastOnce = 1
+)
+
+type status struct {
+	statusMapping
+	cache *xapi.StatusCache
+}
+
+// bridge publishes device status and events to MQTT and runs the commands it
+// receives on the device.
+type bridge struct {
+	cfg    config
+	client *xapi.Client
+	mqtt   mqtt.Client
+	status []*status
+	// byTopic maps the state topic of every status entry to it.
+	byTopic   map[string]*status
+	lock      sync.Mutex
+	available bool
+}
+
+func newBridge(cfg config, client *xapi.Client) (*bridge, error) {
+	b := &bridge{
+		cfg:     cfg,
+		client:  client,
+		byTopic: make(map[string]*status),
+	}
+
+	for _, v := range cfg.Status {
+		cache, err := xapi.NewStatusCache(client, v.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		s := &status{statusMapping: v, cache: cache}
+
+		cache.OnError = func(err error) {
+			log.Printf("status %s: %v", s.Path, err)
+		}
+
+		if _, err := cache.OnChange(v.Path, func(_, v interface{}) {
+			b.publish(b.topic(s.Path), true, payload(v))
+		}); err != nil {
+			return nil, err
+		}
+
+		b.status = append(b.status, s)
+		b.byTopic[b.topic(v.Path)] = s
+	}
+
+	client.OnConnectFunc = b.deviceConnected
+
+	return b, nil
+}
+
+func (b *bridge) base() string {
+	return b.cfg.MQTT.Prefix + "/" + b.cfg.Device
+}
+
+func (b *bridge) availabilityTopic() string {
+	return b.base() + "/" + topicAvailable
+}
+
+// topic is the topic for path, such as xapi/codec/Status/Audio/Volume.  Indexes
+// follow the node name, the same as the slash form ParsePath accepts.
+func (b *bridge) topic(path xapi.Path) string {
+	elems, _ := path.Elements()
+	parts := []string{b.base()}
+
+	for _, e := range elems {
+		parts = append(parts, e.Name)
+
+		switch {
+		case e.Wildcard:
+			parts = append(parts, "*")
+		case e.Indexed:
+			parts = append(parts, strconv.Itoa(e.Index))
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func (b *bridge) deviceConnected(c *xapi.Client) {
+	for _, v := range b.cfg.Events {
+		path := v
+
+		if _, err := c.Subscribe(path, func(data []interface{}) {
+			b.publish(b.topic(path), false, payload(eventValue(data)))
+		}); err != nil {
+			log.Printf("subscribe %s: %v", path, err)
+		}
+	}
+
+	b.setAvailable(true)
+}
+
+// mqttConnected subscribes to the command topics and restores the retained topics
+// after a (re)connect to the broker.
+func (b *bridge) mqttConnected(m mqtt.Client) {
+	// handlers must not block the client as they publish results themselves.
+	handler := func(c mqtt.Client, msg mqtt.Message) {
+		go b.handle(c, msg)
+	}
+
+	if t := m.Subscribe(b.base()+"/#", qosAtLeastOnce, handler); t.Wait() && t.Error() != nil {
+		log.Printf("mqtt subscribe: %v", t.Error())
+	}
+
+	b.lock.Lock()
+	available := b.available
+	b.lock.Unlock()
+
+	b.setAvailable(available)
+
+	for _, s := range b.status {
+		if b.cfg.MQTT.Discovery != "" && s.Name != "" {
+			b.discover(s)
+		}
+
+		if v := s.cache.Snapshot(); v != nil {
+			b.publish(b.topic(s.Path), true, payload(v))
+		}
+	}
+}
+
+func (b *bridge) setAvailable(available bool) {
+	b.lock.Lock()
+	b.available = available
+	b.lock.Unlock()
+
+	p := payloadOffline
+	if available {
+		p = payloadOnline
+	}
+
+	b.publish(b.availabilityTopic(), true, p)
+}
+
+func (b *bridge) publish(topic string, retained bool, payload string) {
+	if b.mqtt == nil || !b.mqtt.IsConnected() {
+		return
+	}
+
+	if t := b.mqtt.Publish(topic, qosAtLeastOnce, retained, payload); t.Wait() && t.Error() != nil {
+		log.Printf("publish %s: %v", topic, t.Error())
+	}
+}
+
+// handle routes the messages for <base>/command/<name...> and <topic>/set.  Our own
+// status and event messages come back here too and are ignored.
+func (b *bridge) handle(_ mqtt.Client, msg mqtt.Message) {
+	rest := strings.TrimPrefix(msg.Topic(), b.base()+"/")
+	body := string(msg.Payload())
+
+	var err error
+
+	switch {
+	case strings.HasPrefix(rest, topicCommand+"/"):
+		err = b.execute(strings.TrimPrefix(rest, topicCommand+"/"), msg.Payload())
+	case strings.HasSuffix(rest, "/"+topicSet):
+		err = b.set(strings.TrimSuffix(msg.Topic(), "/"+topicSet), body)
+	default:
+		return
+	}
+
+	if err != nil {
+		log.Printf("%s: %v", msg.Topic(), err)
+	}
+}
+
+// execute runs the command named by the topic with the JSON object payload as its
+// parameters and publishes the result under <base>/result/<name...>.
+func (b *bridge) execute(name string, body []byte) error {
+	params := map[string]interface{}{}
+
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &params); err != nil {
+			return fmt.Errorf("parameters must be a JSON object: %w", err)
+		}
+	}
+
+	res, err := b.client.Execute(xapi.NewCommand(strings.Split(name, "/")...), params)
+	if err != nil {
+		res = map[string]interface{}{"error": err.Error()}
+	}
+
+	b.publish(b.base()+"/"+topicResult+"/"+name, false, payload(res))
+
+	return err
+}
+
+// set handles a value written to a status or configuration topic.  Status entries run
+// their mapped command, configuration paths are changed with Set.
+func (b *bridge) set(topic string, body string) error {
+	if s, ok := b.byTopic[topic]; ok {
+		if name, ok := s.Commands[body]; ok {
+			_, err := b.client.Execute(xapi.NewCommand(name), nil)
+
+			return err
+		}
+
+		if s.Command == "" {
+			return fmt.Errorf("%s is read only", s.Path)
+		}
+
+		_, err := b.client.Execute(xapi.NewCommand(s.Command), map[string]interface{}{
+			s.Param: value(body),
+		})
+
+		return err
+	}
+
+	path, err := xapi.ParsePath(strings.TrimPrefix(topic, b.base()+"/"))
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(string(path), configRoot+" ") {
+		return fmt.Errorf("%s is not a configuration path", path)
+	}
+
+	return b.client.Set(path, value(body))
+}
+
+// eventValue unwraps the single value most event callbacks get.
+func eventValue(data []interface{}) interface{} {
+	if len(data) == 1 {
+		return data[0]
+	}
+
+	return data
+}
+
+// payload renders scalars as plain text, which is what Home Assistant expects in a
+// state topic, and anything else as JSON.
+func payload(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case bool:
+		return strconv.FormatBool(x)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(data)
+}
+
+// value sends numeric payloads as numbers and everything else as text.  Only payloads
+// that read back the same as a number are converted, so values such as "0123", "1e3"
+// or "nan" stay text.
+func value(body string) interface{} {
+	if i, err := strconv.ParseInt(body, 10, 64); err == nil && strconv.FormatInt(i, 10) == body {
+		return i
+	}
+
+	f, err := strconv.ParseFloat(body, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) || strconv.FormatFloat(f, 'f', -1, 64) != body {
+		return body
+	}
+
+	return f
+}
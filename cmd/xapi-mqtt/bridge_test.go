@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		body string
+		want interface{}
+	}{
+		{"42", int64(42)},
+		{"-7", int64(-7)},
+		{"1.5", 1.5},
+		{"0123", "0123"},
+		{"1.50", "1.50"},
+		{"1e3", "1e3"},
+		{"+5", "+5"},
+		{"inf", "inf"},
+		{"+Inf", "+Inf"},
+		{"nan", "nan"},
+		{"NaN", "NaN"},
+		{"99999999999999999999", "99999999999999999999"},
+		{"on", "on"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := value(tt.body); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("value(%q) = %#v, want %#v", tt.body, got, tt.want)
+		}
+	}
+}
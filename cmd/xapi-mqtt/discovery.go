@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+const (
+	componentSensor = "sensor"
+	componentSwitch = "switch"
+	componentNumber = "number"
+	manufacturer    = "Cisco"
+)
+
+// discover publishes the Home Assistant MQTT discovery message for a status entry so
+// it shows up as an entity of the device without further configuration.
+func (b *bridge) discover(s *status) {
+	component := s.Component
+	if component == "" {
+		component = componentSensor
+	}
+
+	state := b.topic(s.Path)
+	objectID := strings.ToLower(strings.Join(strings.Fields(string(s.Path)), "_"))
+	objectID = strings.NewReplacer("[", "_", "]", "", "*", "all").Replace(objectID)
+
+	msg := map[string]interface{}{
+		"name":               s.Name,
+		"unique_id":          b.cfg.Device + "_" + objectID,
+		"state_topic":        state,
+		"availability_topic": b.availabilityTopic(),
+		"device": map[string]interface{}{
+			"identifiers":  []string{b.cfg.MQTT.Prefix + "_" + b.cfg.Device},
+			"name":         b.cfg.Device,
+			"manufacturer": manufacturer,
+		},
+	}
+
+	if s.Unit != "" {
+		msg["unit_of_measurement"] = s.Unit
+	}
+
+	if s.Command != "" || len(s.Commands) > 0 {
+		msg["command_topic"] = state + "/" + topicSet
+	}
+
+	switch component {
+	case componentSwitch:
+		msg["payload_on"] = "On"
+		msg["payload_off"] = "Off"
+	case componentNumber:
+		if s.Max != 0 {
+			msg["min"] = s.Min
+			msg["max"] = s.Max
+		}
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("discovery %s: %v", s.Path, err)
+
+		return
+	}
+
+	topic := strings.Join([]string{b.cfg.MQTT.Discovery, component, b.cfg.MQTT.Prefix + "_" + b.cfg.Device, objectID, "config"}, "/")
+	b.publish(topic, true, string(data))
+}
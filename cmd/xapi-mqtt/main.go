@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jayaras/xapi"
+	"gopkg.in/yaml.v2"
+)
+
+type mqttConfig struct {
+	Broker   string `yaml:"broker,omitempty"`
+	ClientID string `yaml:"clientId,omitempty"`
+	User     string `yaml:"user,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// Prefix is the root of every topic, topics are <prefix>/<device>/...
+	Prefix string `yaml:"prefix,omitempty"`
+	// Discovery is the Home Assistant discovery prefix, empty disables discovery.
+	Discovery string `yaml:"discovery,omitempty"`
+}
+
+// statusMapping publishes a status path as a retained topic.
+type statusMapping struct {
+	Path xapi.Path `yaml:"path"`
+	// Name of the Home Assistant entity, no discovery message is sent without one.
+	Name string `yaml:"name,omitempty"`
+	// Component is the Home Assistant entity type, sensor by default.
+	Component string `yaml:"component,omitempty"`
+	Unit      string `yaml:"unit,omitempty"`
+	// Command is run with the payload of <topic>/set as Param.
+	Command string `yaml:"command,omitempty"`
+	Param   string `yaml:"param,omitempty"`
+	// Commands maps payloads of <topic>/set to commands run without parameters,
+	// such as On and Off of a switch.
+	Commands map[string]string `yaml:"commands,omitempty"`
+	Min      float64           `yaml:"min,omitempty"`
+	Max      float64           `yaml:"max,omitempty"`
+}
+
+type config struct {
+	URL            string          `yaml:"url,omitempty"`
+	User           string          `yaml:"user,omitempty"`
+	Password       string          `yaml:"password,omitempty"`
+	Insecure       bool            `yaml:"insecure,omitempty"`
+	Debug          bool            `yaml:"debug,omitempty"`
+	Device         string          `yaml:"device,omitempty"`
+	ReconnectDelay time.Duration   `yaml:"reconnectDelay,omitempty"`
+	MQTT           mqttConfig      `yaml:"mqtt"`
+	Status         []statusMapping `yaml:"status,omitempty"`
+	Events         []xapi.Path     `yaml:"events,omitempty"`
+}
+
+func main() {
+	data, err := ioutil.ReadFile("config.yaml")
+	if err != nil {
+		log.Printf("could not read config file: %v", err)
+		os.Exit(1)
+	}
+
+	cfg := config{
+		Device:         "codec",
+		ReconnectDelay: 10 * time.Second,
+		MQTT: mqttConfig{
+			Broker:    "tcp://localhost:1883",
+			Prefix:    "xapi",
+			Discovery: "homeassistant",
+		},
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		log.Printf("could not parse config file: %v", err)
+		os.Exit(1)
+	}
+
+	if cfg.MQTT.ClientID == "" {
+		cfg.MQTT.ClientID = "xapi-" + cfg.Device
+	}
+
+	client := &xapi.Client{
+		URL:      cfg.URL,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Insecure: cfg.Insecure,
+		Logger:   xapi.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), cfg.Debug),
+		// events are published in the order the device sent them.
+		Dispatch: xapi.DispatchSerial,
+	}
+
+	b, err := newBridge(cfg, client)
+	if err != nil {
+		log.Printf("config error: %v", err)
+		os.Exit(1)
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.MQTT.Broker).
+		SetClientID(cfg.MQTT.ClientID).
+		SetUsername(cfg.MQTT.User).
+		SetPassword(cfg.MQTT.Password).
+		SetWill(b.availabilityTopic(), payloadOffline, 1, true).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(b.mqttConnected).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("mqtt connection lost: %v", err)
+		})
+
+	b.mqtt = mqtt.NewClient(opts)
+
+	for {
+		t := b.mqtt.Connect()
+		if t.Wait() && t.Error() == nil {
+			break
+		}
+
+		log.Printf("mqtt connect: %v", t.Error())
+		time.Sleep(cfg.ReconnectDelay)
+	}
+
+	for {
+		if err := client.ConnectAndRun(); err != nil {
+			log.Printf("connection error: %v", err)
+		}
+
+		b.setAvailable(false)
+		time.Sleep(cfg.ReconnectDelay)
+	}
+}
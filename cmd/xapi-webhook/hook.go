@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jayaras/xapi"
+)
+
+const (
+	// queueSize is how many deliveries can wait per hook, for instance while the
+	// receiver is down, before new ones go straight to the dead letter file.
+	queueSize       = 1024
+	signatureHeader = "X-Xapi-Signature"
+	timestampHeader = "X-Xapi-Timestamp"
+	deliveryHeader  = "X-Xapi-Delivery"
+	eventHeader     = "X-Xapi-Event"
+	signaturePrefix = "sha256="
+	deliveryIDBytes = 8
+)
+
+var errQueueFull = errors.New("delivery queue is full")
+
+// payload is the JSON body posted to the hooks.
+type payload struct {
+	ID     string        `json:"id"`
+	Device string        `json:"device"`
+	Event  xapi.Path     `json:"event"`
+	Time   time.Time     `json:"time"`
+	Data   []interface{} `json:"data"`
+}
+
+type delivery struct {
+	payload payload
+	body    []byte
+}
+
+func newDelivery(device string, path xapi.Path, data []interface{}) *delivery {
+	b := make([]byte, deliveryIDBytes)
+	_, _ = rand.Read(b)
+
+	return &delivery{payload: payload{
+		ID:     hex.EncodeToString(b),
+		Device: device,
+		Event:  path,
+		Time:   time.Now().UTC(),
+		Data:   data,
+	}}
+}
+
+// hook delivers events to one URL in the order they were sent, retrying failed
+// deliveries with exponential backoff.  The client dispatches events on a single
+// worker so send is called in the order the device sent them.
+type hook struct {
+	url        string
+	secret     []byte
+	http       *http.Client
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	dead       *deadLetter
+	queue      chan *delivery
+	// sleep waits out the backoff between attempts.
+	sleep func(time.Duration)
+}
+
+// send queues d without blocking the event callback.
+func (h *hook) send(d *delivery) {
+	select {
+	case h.queue <- d:
+	default:
+		h.dead.write(h.url, d, errQueueFull)
+	}
+}
+
+func (h *hook) run() {
+	for d := range h.queue {
+		if err := h.deliver(d); err != nil {
+			log.Printf("hook %s: delivery %s failed: %v", h.url, d.payload.ID, err)
+			h.dead.write(h.url, d, err)
+		}
+	}
+}
+
+func (h *hook) deliver(d *delivery) error {
+	if d.body == nil {
+		body, err := json.Marshal(d.payload)
+		if err != nil {
+			return err
+		}
+
+		d.body = body
+	}
+
+	backoff := h.backoff
+
+	for attempt := 0; ; attempt++ {
+		retry, err := h.post(d)
+		if err == nil || !retry || attempt >= h.retries {
+			return err
+		}
+
+		log.Printf("hook %s: delivery %s attempt %d: %v, retrying in %s", h.url, d.payload.ID, attempt+1, err, backoff)
+		h.sleep(backoff)
+
+		backoff *= 2
+		if backoff > h.maxBackoff {
+			backoff = h.maxBackoff
+		}
+	}
+}
+
+// post makes a single delivery attempt.  It reports whether a failure is worth
+// retrying, which client errors other than 408 and 429 are not.
+func (h *hook) post(d *delivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(deliveryHeader, d.payload.ID)
+	req.Header.Set(eventHeader, string(d.payload.Event))
+	req.Header.Set(timestampHeader, ts)
+
+	if len(h.secret) > 0 {
+		req.Header.Set(signatureHeader, signaturePrefix+sign(h.secret, ts, d.body))
+	}
+
+	resp, err := h.http.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode < http.StatusMultipleChoices:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= http.StatusInternalServerError:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// sign is the hex HMAC-SHA256 of the timestamp, a dot and the body.  Covering the
+// timestamp lets receivers reject replayed requests.
+func sign(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetter appends deliveries that could not be made to a JSON lines file so they
+// can be inspected or replayed.
+type deadLetter struct {
+	path string
+	lock sync.Mutex
+}
+
+type deadEntry struct {
+	URL     string    `json:"url"`
+	Error   string    `json:"error"`
+	Time    time.Time `json:"time"`
+	Payload payload   `json:"payload"`
+}
+
+func (dl *deadLetter) write(url string, d *delivery, err error) {
+	line, merr := json.Marshal(deadEntry{
+		URL:     url,
+		Error:   err.Error(),
+		Time:    time.Now().UTC(),
+		Payload: d.payload,
+	})
+	if merr != nil {
+		log.Printf("dead letter %s: %v", d.payload.ID, merr)
+
+		return
+	}
+
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	f, ferr := os.OpenFile(dl.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if ferr != nil {
+		log.Printf("dead letter %s: %v", d.payload.ID, ferr)
+
+		return
+	}
+
+	defer f.Close()
+
+	if _, ferr := f.Write(append(line, '\n')); ferr != nil {
+		log.Printf("dead letter %s: %v", d.payload.ID, ferr)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jayaras/xapi"
+)
+
+// newTestHook returns a hook posting to a server answering with the statuses in
+// order, repeating the last one.  The backoffs slept are recorded instead of waited.
+func newTestHook(t *testing.T, statuses ...int) (*hook, *int32, *[]time.Duration) {
+	t.Helper()
+
+	var calls int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1)) - 1
+		if n >= len(statuses) {
+			n = len(statuses) - 1
+		}
+
+		w.WriteHeader(statuses[n])
+	}))
+	t.Cleanup(srv.Close)
+
+	var slept []time.Duration
+
+	h := &hook{
+		url:        srv.URL,
+		http:       srv.Client(),
+		retries:    5,
+		backoff:    time.Second,
+		maxBackoff: 4 * time.Second,
+		dead:       &deadLetter{path: filepath.Join(t.TempDir(), "dead.jsonl")},
+		queue:      make(chan *delivery, 1),
+		sleep:      func(d time.Duration) { slept = append(slept, d) },
+	}
+
+	return h, &calls, &slept
+}
+
+func TestSign(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"1"}`)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("1700000000." + string(body)))
+
+	if got, want := sign(secret, "1700000000", body), hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("sign %s, want %s", got, want)
+	}
+}
+
+func TestSignatureHeaderVerifies(t *testing.T) {
+	secret := []byte("secret")
+	verified := make(chan bool, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		sig := strings.TrimPrefix(r.Header.Get(signatureHeader), signaturePrefix)
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(r.Header.Get(timestampHeader) + "."))
+		mac.Write(body)
+
+		want := hex.EncodeToString(mac.Sum(nil))
+		verified <- hmac.Equal([]byte(sig), []byte(want)) && r.Header.Get(deliveryHeader) != ""
+	}))
+	defer srv.Close()
+
+	h := &hook{url: srv.URL, secret: secret, http: srv.Client()}
+
+	if err := h.deliver(newDelivery("codec", xapi.EventShutdown, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !<-verified {
+		t.Fatal("signature header does not verify")
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		status int
+		calls  int32
+	}{
+		{http.StatusInternalServerError, 6},
+		{http.StatusBadGateway, 6},
+		{http.StatusRequestTimeout, 6},
+		{http.StatusTooManyRequests, 6},
+		{http.StatusBadRequest, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusUnauthorized, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			h, calls, _ := newTestHook(t, tt.status)
+
+			if err := h.deliver(newDelivery("codec", xapi.EventShutdown, nil)); err == nil {
+				t.Fatal("failed delivery returned nil")
+			}
+
+			if *calls != tt.calls {
+				t.Fatalf("%d attempts, want %d", *calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDeliverSucceedsAfterRetry(t *testing.T) {
+	h, calls, _ := newTestHook(t, http.StatusServiceUnavailable, http.StatusOK)
+
+	if err := h.deliver(newDelivery("codec", xapi.EventShutdown, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if *calls != 2 {
+		t.Fatalf("%d attempts, want 2", *calls)
+	}
+}
+
+func TestBackoffCapped(t *testing.T) {
+	h, _, slept := newTestHook(t, http.StatusInternalServerError)
+
+	_ = h.deliver(newDelivery("codec", xapi.EventShutdown, nil))
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second, 4 * time.Second}
+	if len(*slept) != len(want) {
+		t.Fatalf("slept %v, want %v", *slept, want)
+	}
+
+	for i := range want {
+		if (*slept)[i] != want[i] {
+			t.Fatalf("slept %v, want %v", *slept, want)
+		}
+	}
+}
+
+func readDead(t *testing.T, path string) []deadEntry {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var res []deadEntry
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e deadEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("dead letter line %q: %v", sc.Text(), err)
+		}
+
+		res = append(res, e)
+	}
+
+	return res
+}
+
+func TestDeadLetterOnFailure(t *testing.T) {
+	h, _, _ := newTestHook(t, http.StatusBadRequest)
+	d := newDelivery("codec", xapi.EventShutdown, []interface{}{"x"})
+
+	go h.run()
+	h.queue <- d
+	close(h.queue)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(h.dead.path); err == nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("no dead letter written")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	entries := readDead(t, h.dead.path)
+	if len(entries) != 1 || entries[0].URL != h.url || entries[0].Payload.ID != d.payload.ID ||
+		!strings.Contains(entries[0].Error, "400") {
+		t.Fatalf("dead letters %+v", entries)
+	}
+}
+
+func TestDeadLetterOnQueueFull(t *testing.T) {
+	h, _, _ := newTestHook(t, http.StatusOK)
+
+	first := newDelivery("codec", xapi.EventShutdown, nil)
+	second := newDelivery("codec", xapi.EventShutdown, nil)
+
+	// nothing runs the queue, so the second delivery does not fit.
+	h.send(first)
+	h.send(second)
+
+	entries := readDead(t, h.dead.path)
+	if len(entries) != 1 || entries[0].Payload.ID != second.payload.ID || entries[0].Error != errQueueFull.Error() {
+		t.Fatalf("dead letters %+v", entries)
+	}
+}
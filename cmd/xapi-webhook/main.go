@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jayaras/xapi"
+	"gopkg.in/yaml.v2"
+)
+
+// hookConfig is a single webhook receiving the listed events.
+type hookConfig struct {
+	URL string `yaml:"url"`
+	// Secret signs the requests, no signature is sent without one.
+	Secret string      `yaml:"secret,omitempty"`
+	Events []xapi.Path `yaml:"events"`
+}
+
+type config struct {
+	URL            string        `yaml:"url,omitempty"`
+	User           string        `yaml:"user,omitempty"`
+	Password       string        `yaml:"password,omitempty"`
+	Insecure       bool          `yaml:"insecure,omitempty"`
+	Debug          bool          `yaml:"debug,omitempty"`
+	Device         string        `yaml:"device,omitempty"`
+	ReconnectDelay time.Duration `yaml:"reconnectDelay,omitempty"`
+	// Retries is how many times a failed delivery is retried before it is written
+	// to the dead letter file.
+	Retries int `yaml:"retries,omitempty"`
+	// Backoff is the delay before the first retry, it doubles up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff,omitempty"`
+	MaxBackoff time.Duration `yaml:"maxBackoff,omitempty"`
+	Timeout    time.Duration `yaml:"timeout,omitempty"`
+	DeadLetter string        `yaml:"deadLetter,omitempty"`
+	Hooks      []hookConfig  `yaml:"hooks,omitempty"`
+}
+
+func main() {
+	data, err := ioutil.ReadFile("config.yaml")
+	if err != nil {
+		log.Printf("could not read config file: %v", err)
+		os.Exit(1)
+	}
+
+	cfg := config{
+		Device:         "codec",
+		ReconnectDelay: 10 * time.Second,
+		Retries:        5,
+		Backoff:        time.Second,
+		MaxBackoff:     5 * time.Minute,
+		Timeout:        10 * time.Second,
+		DeadLetter:     "deadletter.jsonl",
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		log.Printf("could not parse config file: %v", err)
+		os.Exit(1)
+	}
+
+	client := &xapi.Client{
+		URL:      cfg.URL,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Insecure: cfg.Insecure,
+		Logger:   xapi.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), cfg.Debug),
+		// a single worker queues the deliveries in the order the device sent the
+		// events, across all paths.  The callbacks only queue so one is enough.
+		Dispatch:        xapi.DispatchPool,
+		DispatchWorkers: 1,
+	}
+
+	dead := &deadLetter{path: cfg.DeadLetter}
+	httpClient := &http.Client{Timeout: cfg.Timeout}
+
+	var hooks []*hook
+
+	for _, v := range cfg.Hooks {
+		h := &hook{
+			url:        v.URL,
+			secret:     []byte(v.Secret),
+			http:       httpClient,
+			retries:    cfg.Retries,
+			backoff:    cfg.Backoff,
+			maxBackoff: cfg.MaxBackoff,
+			dead:       dead,
+			queue:      make(chan *delivery, queueSize),
+			sleep:      time.Sleep,
+		}
+
+		go h.run()
+
+		hooks = append(hooks, h)
+	}
+
+	client.OnConnectFunc = func(c *xapi.Client) {
+		for i, v := range cfg.Hooks {
+			h := hooks[i]
+
+			for _, p := range v.Events {
+				path := p
+
+				if _, err := c.Subscribe(path, func(data []interface{}) {
+					h.send(newDelivery(cfg.Device, path, data))
+				}); err != nil {
+					log.Printf("subscribe %s: %v", path, err)
+				}
+			}
+		}
+	}
+
+	for {
+		if err := client.ConnectAndRun(); err != nil {
+			log.Printf("connection error: %v", err)
+		}
+
+		time.Sleep(cfg.ReconnectDelay)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jayaras/xapi"
+)
+
+const (
+	statusRoot = "Status"
+	configRoot = "Configuration"
+	eventRoot  = "Event"
+	// idField is the instance id of multi-instance nodes, which is not a path node.
+	idField = "id"
+)
+
+// knownCommands are completed after cmd.  The device has no way to list its commands
+// over the websocket so these are the common ones, anything else can still be typed.
+var knownCommands = []string{
+	"Audio Microphones Mute",
+	"Audio Microphones ToggleMute",
+	"Audio Microphones Unmute",
+	"Audio Volume Decrease",
+	"Audio Volume Increase",
+	"Audio Volume Mute",
+	"Audio Volume Set",
+	"Audio Volume Unmute",
+	"Bookings List",
+	"Call Accept",
+	"Call Disconnect",
+	"Call Hold",
+	"Call Reject",
+	"Call Resume",
+	"Camera Preset Activate",
+	"Dial",
+	"Macros Macro Activate",
+	"Macros Macro Deactivate",
+	"Macros Macro Get",
+	"Macros Macro Remove",
+	"Macros Macro Save",
+	"Macros Runtime Restart",
+	"Presentation Start",
+	"Presentation Stop",
+	"Standby Activate",
+	"Standby Deactivate",
+	"Standby Halfwake",
+	"SystemUnit Boot",
+	"UserInterface Extensions List",
+	"UserInterface Extensions Widget SetValue",
+	"UserInterface Extensions Widget UnsetValue",
+	"UserInterface Message Alert Clear",
+	"UserInterface Message Alert Display",
+	"UserInterface Message Prompt Clear",
+	"UserInterface Message Prompt Display",
+	"UserInterface Message Rating Clear",
+	"UserInterface Message Rating Display",
+	"UserInterface Message TextInput Clear",
+	"UserInterface Message TextInput Display",
+	"UserInterface Message TextLine Clear",
+	"UserInterface Message TextLine Display",
+	"Video Selfview Set",
+}
+
+// knownEvents are the events the library knows about.  Unlike status and configuration
+// the event tree can't be read from the device.
+var knownEvents = []xapi.Path{
+	xapi.EventUserInterfaceExtensionsEventReleased,
+	xapi.EventUserInterfaceExtensionsEventClicked,
+	xapi.EventUserInterfaceExtensionsEventChanged,
+	xapi.EventUserInterfaceWidgetAction,
+	xapi.EventUserInterfaceWidgetLayoutUpdated,
+	xapi.EventUserInterfacePanelClicked,
+	xapi.EventUserInterfacePanelClose,
+	xapi.EventUserInterfacePanelOpen,
+	xapi.EventUserInterfacePromptResponse,
+	xapi.EventUserInterfaceRatingResponse,
+	xapi.EventUserInterfaceTextInputResponse,
+	xapi.EventUserInterfaceTextInputResponseClear,
+	xapi.EventUserInterfaceMessagePromptCleared,
+	xapi.EventUserInterfaceMessageAlertCleared,
+	xapi.EventUserInterfaceMessageRatingCleared,
+	xapi.EventUserInterfaceMessageTextLineCleared,
+	xapi.EventMacrosLog,
+	xapi.EventShutdown,
+	xapi.EventIncomingCallIndication,
+}
+
+var verbs = []string{verbGet, verbSet, verbCmd, verbWatch, verbUnwatch, verbFormat, verbHelp, verbExit}
+
+// node is a level of the completion tree.  Children are keyed by lower case name.
+type node struct {
+	name     string
+	children map[string]*node
+}
+
+func newNode(name string) *node {
+	return &node{name: name, children: make(map[string]*node)}
+}
+
+func (n *node) child(name string) *node {
+	key := strings.ToLower(name)
+
+	c, ok := n.children[key]
+	if !ok {
+		c = newNode(name)
+		n.children[key] = c
+	}
+
+	return c
+}
+
+func (n *node) addWords(words []string) {
+	for _, w := range words {
+		n = n.child(w)
+	}
+}
+
+// addValue adds the keys of a status or configuration document.  Lists of instances
+// are flattened as the index is typed as a number that completion skips, and their
+// id fields are left out.
+func (n *node) addValue(v interface{}) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, v := range x {
+			if k == idField {
+				continue
+			}
+
+			n.child(k).addValue(v)
+		}
+	case []interface{}:
+		for _, v := range x {
+			n.addValue(v)
+		}
+	}
+}
+
+type completer struct {
+	client *xapi.Client
+	out    io.Writer
+	lock   sync.Mutex
+	paths  *node
+	cmds   *node
+}
+
+func newCompleter(c *xapi.Client, out io.Writer) *completer {
+	comp := &completer{
+		client: c,
+		out:    out,
+		paths:  newNode(""),
+		cmds:   newNode(""),
+	}
+
+	comp.paths.child(statusRoot)
+	comp.paths.child(configRoot)
+
+	for _, v := range knownEvents {
+		comp.paths.addWords(strings.Fields(string(v)))
+	}
+
+	for _, v := range knownCommands {
+		comp.cmds.addWords(strings.Fields(v))
+	}
+
+	return comp
+}
+
+// load reads the status and configuration trees of the device for completion.
+func (comp *completer) load() {
+	for _, root := range []xapi.Path{statusRoot, configRoot} {
+		v, err := comp.client.Get(root)
+		if err != nil {
+			continue
+		}
+
+		comp.lock.Lock()
+		comp.paths.addValue(map[string]interface{}{string(root): v})
+		comp.lock.Unlock()
+	}
+}
+
+// complete is the terminal AutoCompleteCallback.  It completes the word before the
+// cursor, to the common prefix when there are several candidates, and lists them
+// when nothing more can be completed.
+func (comp *completer) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	before := line[:pos]
+	words := strings.Fields(before)
+
+	if len(words) == 0 || strings.HasSuffix(before, " ") {
+		words = append(words, "")
+	}
+
+	partial := words[len(words)-1]
+
+	var candidates []string
+
+	if len(words) == 1 {
+		candidates = matching(verbs, partial)
+	} else {
+		comp.lock.Lock()
+		candidates = comp.candidates(words[0], words[1:len(words)-1], partial)
+		comp.lock.Unlock()
+	}
+
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+
+	word := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		word += " "
+	}
+
+	if len(word) <= len(partial) {
+		go fmt.Fprintln(comp.out, strings.Join(candidates, "  "))
+
+		return "", 0, false
+	}
+
+	start := len(before) - len(partial)
+
+	return line[:start] + word + line[pos:], start + len(word), true
+}
+
+func (comp *completer) candidates(verb string, words []string, partial string) []string {
+	var n *node
+
+	switch strings.ToLower(verb) {
+	case verbGet, verbSet, verbWatch, verbUnwatch:
+		n = comp.paths
+	case verbCmd:
+		n = comp.cmds
+	case verbFormat:
+		return matching([]string{formatPretty, formatRaw, formatYAML}, partial)
+	default:
+		return nil
+	}
+
+	for _, w := range words {
+		if _, err := strconv.Atoi(w); err == nil || strings.Contains(w, "=") || strings.EqualFold(w, commandRoot) {
+			continue
+		}
+
+		next, ok := n.children[strings.ToLower(w)]
+		if !ok {
+			return nil
+		}
+
+		n = next
+	}
+
+	names := make([]string, 0, len(n.children))
+	for _, c := range n.children {
+		names = append(names, c.name)
+	}
+
+	return matching(names, partial)
+}
+
+func matching(names []string, partial string) []string {
+	var res []string
+
+	for _, v := range names {
+		if strings.HasPrefix(strings.ToLower(v), strings.ToLower(partial)) {
+			res = append(res, v)
+		}
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+// commonPrefix is the longest prefix shared by all the names, ignoring case.
+func commonPrefix(names []string) string {
+	prefix := names[0]
+
+	for _, v := range names[1:] {
+		i := 0
+		for i < len(prefix) && i < len(v) && strings.EqualFold(prefix[i:i+1], v[i:i+1]) {
+			i++
+		}
+
+		prefix = prefix[:i]
+	}
+
+	return prefix
+}
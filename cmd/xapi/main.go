@@ -0,0 +1,129 @@
+// Command xapi runs xAPI requests against a Webex device from the command line:
+//
+//	xapi get Status Audio Volume
+//	xapi set Configuration Audio DefaultVolume 50
+//	xapi cmd UserInterface Message Alert Display Title="Hello" Text="World" Duration=5
+//	xapi watch Event UserInterface
+//
+// Without a command it starts an interactive shell with tab completion and history.
+// The device is set with flags or the XAPI_URL, XAPI_USER, XAPI_PASSWORD and
+// XAPI_INSECURE environment variables.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/jayaras/xapi"
+)
+
+const usage = `usage: xapi [flags] [command]
+
+commands:
+  get <path>                   read a status or configuration value
+  set <path> <value>           change a configuration value
+  cmd <command> [Key=Value...] run a command
+  watch <path>                 stream events or status changes till interrupted
+  repl                         interactive shell, the default without a command
+
+flags:
+`
+
+func main() {
+	envInsecure, _ := strconv.ParseBool(os.Getenv("XAPI_INSECURE"))
+
+	url := flag.String("url", os.Getenv("XAPI_URL"), "websocket URL of the device, such as wss://10.0.0.5/ws")
+	user := flag.String("user", os.Getenv("XAPI_USER"), "device user")
+	password := flag.String("password", os.Getenv("XAPI_PASSWORD"), "device password")
+	insecure := flag.Bool("insecure", envInsecure, "skip TLS certificate verification")
+	format := flag.String("o", formatPretty, "output format: json, raw or yaml")
+	debug := flag.Bool("debug", false, "log the JSON-RPC frames")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if !validFormat(*format) {
+		fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	logger := xapi.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), *debug)
+	if !*debug {
+		logger = quietLogger{logger}
+	}
+
+	client := &xapi.Client{
+		URL:      *url,
+		User:     *user,
+		Password: *password,
+		Insecure: *insecure,
+		Logger:   logger,
+	}
+
+	if err := client.Connect(); err != nil {
+		fail(err)
+	}
+
+	runErr := make(chan error, 1)
+
+	go func() {
+		runErr <- client.Run()
+	}()
+
+	s := newSession(client, os.Stdout, *format)
+	args := flag.Args()
+
+	var err error
+
+	switch {
+	case len(args) == 0 || args[0] == verbRepl:
+		err = repl(s, runErr)
+	case args[0] == verbWatch:
+		err = watch(s, args[1:], runErr)
+	default:
+		err = s.exec(args)
+	}
+
+	_ = client.Close()
+
+	if err != nil {
+		fail(err)
+	}
+}
+
+// watch streams the events of a path till interrupted or disconnected.
+func watch(s *session, args []string, runErr <-chan error) error {
+	if err := s.watch(args); err != nil {
+		return err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+
+	select {
+	case <-sig:
+		return nil
+	case err := <-runErr:
+		return err
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "xapi: %v\n", err)
+	os.Exit(1)
+}
+
+// quietLogger drops the info level connection chatter, which would otherwise be
+// mixed into the output.
+type quietLogger struct {
+	xapi.Logger
+}
+
+func (quietLogger) Info(string, ...interface{}) {}
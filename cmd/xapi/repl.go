@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	prompt   = "xapi> "
+	replHelp = `commands:
+  get <path>                   read a status or configuration value
+  set <path> <value>           change a configuration value
+  cmd <command> [Key=Value...] run a command
+  watch <path>                 print events or status changes in the background
+  unwatch [path]               stop watching a path, or all of them
+  format json|raw|yaml         change the output format
+  help                         show this help
+  exit                         leave the shell
+Whole numbers are sent as numbers, quote a value to send it as text: Pin="1234".
+Tab completes commands and paths, up and down go through the history.
+`
+	verbFormat = "format"
+	verbHelp   = "help"
+	verbExit   = "exit"
+	verbQuit   = "quit"
+)
+
+// lineReader is a terminal with line editing or a plain line scanner when the input
+// is not a terminal, such as a script piped in.
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+type scanReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r scanReader) ReadLine() (string, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+
+		return "", io.EOF
+	}
+
+	return r.scanner.Text(), nil
+}
+
+// repl runs the interactive shell till exit, end of input or a connection error.
+func repl(s *session, runErr <-chan error) error {
+	var in lineReader = scanReader{bufio.NewScanner(os.Stdin)}
+
+	fd := int(os.Stdin.Fd())
+
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+
+		defer func() { _ = term.Restore(fd, state) }()
+
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}, prompt)
+
+		if w, h, err := term.GetSize(fd); err == nil {
+			_ = t.SetSize(w, h)
+		}
+
+		comp := newCompleter(s.client, t)
+		t.AutoCompleteCallback = comp.complete
+		s.out = t
+		in = t
+
+		go comp.load()
+	}
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+
+	go func() {
+		for {
+			line, err := in.ReadLine()
+			if err != nil {
+				readErr <- err
+
+				return
+			}
+
+			lines <- line
+		}
+	}()
+
+	for {
+		var line string
+
+		select {
+		case line = <-lines:
+		case err := <-readErr:
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		case err := <-runErr:
+			return err
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+
+			continue
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		switch strings.ToLower(args[0]) {
+		case verbExit, verbQuit:
+			return nil
+		case verbHelp:
+			fmt.Fprint(s.out, replHelp)
+		case verbFormat:
+			if len(args) != 2 {
+				err = fmt.Errorf("%v: format json|raw|yaml", errUsage)
+			} else {
+				format, _ := unquote(args[1])
+				err = s.setFormat(format)
+			}
+		case verbWatch:
+			if len(args) == 1 {
+				for _, v := range s.watching() {
+					fmt.Fprintln(s.out, v)
+				}
+			} else {
+				err = s.watch(args[1:])
+			}
+		case verbUnwatch:
+			err = s.unwatch(args[1:])
+		default:
+			args[0] = strings.ToLower(args[0])
+			err = s.exec(args)
+		}
+
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jayaras/xapi"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	verbGet     = "get"
+	verbSet     = "set"
+	verbCmd     = "cmd"
+	verbWatch   = "watch"
+	verbUnwatch = "unwatch"
+	verbRepl    = "repl"
+
+	formatPretty = "json"
+	formatRaw    = "raw"
+	formatYAML   = "yaml"
+
+	commandRoot = "xCommand"
+)
+
+var (
+	errUsage           = errors.New("missing arguments")
+	errAlreadyWatching = errors.New("already watching")
+)
+
+// session runs the commands shared by the command line and the interactive shell.
+type session struct {
+	client  *xapi.Client
+	lock    sync.Mutex
+	out     io.Writer
+	format  string
+	watches map[xapi.Path]func() error
+}
+
+func newSession(c *xapi.Client, out io.Writer, format string) *session {
+	return &session{
+		client:  c,
+		out:     out,
+		format:  format,
+		watches: make(map[xapi.Path]func() error),
+	}
+}
+
+// exec runs a get, set or cmd command.
+func (s *session) exec(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("%v: see -h", errUsage)
+	}
+
+	switch args[0] {
+	case verbGet:
+		path, err := parsePath(args[1:])
+		if err != nil {
+			return err
+		}
+
+		v, err := s.client.Get(path)
+		if err != nil {
+			return err
+		}
+
+		return s.print(v)
+	case verbSet:
+		if len(args) < 3 {
+			return fmt.Errorf("%v: set <path> <value>", errUsage)
+		}
+
+		path, err := parsePath(args[1 : len(args)-1])
+		if err != nil {
+			return err
+		}
+
+		return s.client.Set(path, argValue(args[len(args)-1]))
+	case verbCmd:
+		cmd, params := parseCommand(args[1:])
+
+		res, err := s.client.Execute(cmd, params)
+		if err != nil {
+			return err
+		}
+
+		return s.print(res)
+	}
+
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// watch subscribes to a path and prints everything received for it.
+func (s *session) watch(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%v: watch <path>", errUsage)
+	}
+
+	path, err := parsePath(args)
+	if err != nil {
+		return err
+	}
+
+	if s.isWatching(path) {
+		return fmt.Errorf("%s: %w", path, errAlreadyWatching)
+	}
+
+	cancel, err := s.client.Subscribe(path, func(data []interface{}) {
+		var v interface{} = data
+		if len(data) == 1 {
+			v = data[0]
+		}
+
+		if err := s.print(v); err != nil {
+			fmt.Fprintf(s.out, "%s: %v\n", path, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	_, dup := s.watches[path]
+	if !dup {
+		s.watches[path] = cancel
+	}
+	s.lock.Unlock()
+
+	// another watch of the path got in while this one subscribed.
+	if dup {
+		if err := cancel(); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%s: %w", path, errAlreadyWatching)
+	}
+
+	return nil
+}
+
+func (s *session) isWatching(path xapi.Path) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.watches[path]
+
+	return ok
+}
+
+// unwatch stops watching a path, or every path without arguments.
+func (s *session) unwatch(args []string) error {
+	var path xapi.Path
+
+	if len(args) > 0 {
+		var err error
+
+		if path, err = parsePath(args); err != nil {
+			return err
+		}
+	}
+
+	// the watches are taken out under the lock and canceled after, so the
+	// unsubscribes don't hold up printing or other commands.
+	s.lock.Lock()
+	cancels := make(map[xapi.Path]func() error)
+
+	for k, cancel := range s.watches {
+		if path != "" && k != path {
+			continue
+		}
+
+		cancels[k] = cancel
+		delete(s.watches, k)
+	}
+	s.lock.Unlock()
+
+	var res error
+
+	for k, cancel := range cancels {
+		if err := cancel(); err != nil && res == nil {
+			res = fmt.Errorf("unwatch %s: %w", k, err)
+		}
+	}
+
+	return res
+}
+
+func (s *session) watching() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := make([]string, 0, len(s.watches))
+	for k := range s.watches {
+		res = append(res, string(k))
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+func (s *session) print(v interface{}) error {
+	var (
+		data []byte
+		err  error
+	)
+
+	s.lock.Lock()
+	format := s.format
+	s.lock.Unlock()
+
+	switch format {
+	case formatRaw:
+		data, err = json.Marshal(v)
+	case formatYAML:
+		data, err = yaml.Marshal(v)
+		data = append([]byte("---\n"), data...)
+	default:
+		data, err = json.MarshalIndent(v, "", "  ")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+
+	_, err = s.out.Write(data)
+
+	return err
+}
+
+func (s *session) setFormat(format string) error {
+	if !validFormat(format) {
+		return fmt.Errorf("unknown output format %q", format)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.format = format
+
+	return nil
+}
+
+func validFormat(format string) bool {
+	return format == formatPretty || format == formatRaw || format == formatYAML
+}
+
+// parsePath parses the path given as one or more arguments.
+func parsePath(args []string) (xapi.Path, error) {
+	parts := make([]string, len(args))
+	for i, v := range args {
+		parts[i], _ = unquote(v)
+	}
+
+	return xapi.ParsePath(strings.Join(parts, " "))
+}
+
+// parseCommand splits command arguments into the command nodes and its Key=Value
+// parameters.  The xCommand prefix of the device CLI is dropped.
+func parseCommand(args []string) (xapi.Command, map[string]interface{}) {
+	var nodes []string
+
+	params := map[string]interface{}{}
+
+	for _, v := range args {
+		if i := strings.Index(v, "="); i > 0 && !strings.ContainsAny(v[:i], quoteChars) {
+			params[v[:i]] = argValue(v[i+1:])
+
+			continue
+		}
+
+		node, _ := unquote(v)
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) > 0 && strings.EqualFold(nodes[0], commandRoot) {
+		nodes = nodes[1:]
+	}
+
+	return xapi.NewCommand(nodes...), params
+}
+
+// argValue sends whole numbers as numbers and everything else as text.  Only numbers
+// that read back the same are converted, so "0123" stays text, and quoting a value
+// always sends it as text.
+func argValue(s string) interface{} {
+	v, quoted := unquote(s)
+	if quoted {
+		return v
+	}
+
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil && strconv.FormatInt(i, 10) == v {
+		return i
+	}
+
+	return v
+}
+
+const quoteChars = `"'`
+
+// unquote removes the quotes from an argument and reports if it had any.
+func unquote(s string) (string, bool) {
+	var (
+		b      strings.Builder
+		quote  rune
+		quoted bool
+	)
+
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			b.WriteRune(r)
+		case strings.ContainsRune(quoteChars, r):
+			quote = r
+			quoted = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String(), quoted
+}
+
+// splitArgs splits a shell line into arguments, keeping quoted text together so
+// values like Text="Hello World" work.  The quotes are kept in the arguments so
+// quoted values can be told apart, see argValue.
+func splitArgs(line string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		quote   rune
+		started bool
+	)
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+
+			cur.WriteRune(r)
+		case strings.ContainsRune(quoteChars, r):
+			quote = r
+			started = true
+
+			cur.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if started {
+				args = append(args, cur.String())
+				cur.Reset()
+				started = false
+			}
+		default:
+			cur.WriteRune(r)
+			started = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+
+	if started {
+		args = append(args, cur.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/jayaras/xapi"
+)
+
+func TestArgValue(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want interface{}
+	}{
+		{"50", int64(50)},
+		{"-3", int64(-3)},
+		{"0123", "0123"},
+		{"+5", "+5"},
+		{"1.5", "1.5"},
+		{"99999999999999999999", "99999999999999999999"},
+		{`"50"`, "50"},
+		{`'50'`, "50"},
+		{`"Hello World"`, "Hello World"},
+		{"On", "On"},
+	}
+
+	for _, tt := range tests {
+		if got := argValue(tt.arg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("argValue(%q) = %#v, want %#v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"get Status Audio", []string{"get", "Status", "Audio"}},
+		{`cmd Dial Number="1 2 3"`, []string{"cmd", "Dial", `Number="1 2 3"`}},
+		{`set Audio Volume '50'`, []string{"set", "Audio", "Volume", `'50'`}},
+		{"  watch\tEvent  ", []string{"watch", "Event"}},
+	}
+
+	for _, tt := range tests {
+		got, err := splitArgs(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	if _, err := splitArgs(`cmd Text="open`); err == nil {
+		t.Error("unterminated quote accepted")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	args, err := splitArgs(`xCommand "Dial" Number="0123" CallRate=768 Pin='42'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, params := parseCommand(args)
+
+	if cmd != xapi.NewCommand("Dial") {
+		t.Errorf("command %s", cmd)
+	}
+
+	want := map[string]interface{}{"Number": "0123", "CallRate": int64(768), "Pin": "42"}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("params %#v, want %#v", params, want)
+	}
+}
+
+func TestAddValueSkipsID(t *testing.T) {
+	n := newNode("")
+	n.addValue(map[string]interface{}{"Status": map[string]interface{}{
+		"Video": map[string]interface{}{"Input": map[string]interface{}{"Connector": []interface{}{
+			map[string]interface{}{"id": "1", "Connected": "True"},
+		}}},
+	}})
+
+	connector := n.child("Status").child("Video").child("Input").child("Connector")
+
+	if _, ok := connector.children["id"]; ok {
+		t.Error("id offered as a path node")
+	}
+
+	if _, ok := connector.children["connected"]; !ok {
+		t.Error("Connected missing")
+	}
+}
+
+func TestWatchTwice(t *testing.T) {
+	s := newSession(&xapi.Client{}, ioutil.Discard, formatPretty)
+
+	canceled := 0
+	s.watches[xapi.EventShutdown] = func() error {
+		canceled++
+
+		return nil
+	}
+
+	if err := s.watch([]string{"Event", "Shutdown"}); !errors.Is(err, errAlreadyWatching) {
+		t.Fatalf("watch returned %v, want errAlreadyWatching", err)
+	}
+
+	if err := s.unwatch([]string{"Event", "Shutdown"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if canceled != 1 || len(s.watches) != 0 {
+		t.Fatalf("%d cancels, %d watches left", canceled, len(s.watches))
+	}
+}
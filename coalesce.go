@@ -0,0 +1,206 @@
+package xapi
+
+import (
+	"sync"
+	"time"
+)
+
+// SubscribeOption changes how events of a subscription are delivered.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	debounce   time.Duration
+	throttle   time.Duration
+	latestOnly bool
+	serial     bool
+	inline     bool
+}
+
+// coalesce reports if any of the options coalescing events are set.
+func (o subscribeOptions) coalesce() bool {
+	return o.debounce > 0 || o.throttle > 0 || o.latestOnly
+}
+
+// WithSerialDelivery delivers the events of the subscription one at a time in the
+// order they arrived, the same as DispatchSerial, whatever the Dispatch mode of the
+// client.  Use it for callbacks that apply updates on top of each other.
+func WithSerialDelivery() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.serial = true
+	}
+}
+
+// withInlineDelivery runs the callback on the run loop itself, so it sees the state of
+// the client as of the event, before any later response was handled.  The callback
+// must not block or send commands.
+func withInlineDelivery() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.inline = true
+	}
+}
+
+// WithDebounce delivers an event only once no newer event arrived for d, so a burst
+// of events results in a single call with the last of them.
+func WithDebounce(d time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.debounce = d
+	}
+}
+
+// WithThrottle delivers at most one event every d.  The first event is delivered right
+// away and the last event of a burst is delivered at the end of the interval.
+func WithThrottle(d time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.throttle = d
+	}
+}
+
+// WithLatestOnly drops the events that pile up while the callback is busy, only the
+// latest of them is delivered once it returns.
+func WithLatestOnly() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.latestOnly = true
+	}
+}
+
+type coalesceState struct {
+	// gen changes whenever a pending timer is stopped or replaced, so a timer that
+	// already fired can tell it is stale.
+	gen      uint64
+	timer    *time.Timer
+	pending  []interface{}
+	lastSent time.Time
+	queue    [][]interface{}
+	running  bool
+}
+
+// coalescer implements the SubscribeOptions.  Events are coalesced per widget so
+// dragging one slider does not swallow the events of another, and released events
+// are always delivered right away so the final value is never lost.  handle has to be
+// called in the order the events arrived, deliveries are then made one at a time per
+// widget in that same order.
+type coalescer struct {
+	opts  subscribeOptions
+	run   func([]interface{})
+	lock  sync.Mutex
+	state map[string]*coalesceState
+}
+
+func newCoalescer(opts subscribeOptions, run func([]interface{})) *coalescer {
+	return &coalescer{
+		opts:  opts,
+		run:   run,
+		state: make(map[string]*coalesceState),
+	}
+}
+
+func (co *coalescer) handle(data []interface{}) {
+	key, _ := mapField(data, widgetIDField).(string)
+	final := mapField(data, widgetTypeField) == string(WidgetReleased)
+
+	co.lock.Lock()
+	defer co.lock.Unlock()
+
+	s, ok := co.state[key]
+	if !ok {
+		s = &coalesceState{}
+		co.state[key] = s
+	}
+
+	switch {
+	case final:
+		co.stop(s)
+		s.lastSent = time.Now()
+	case co.opts.debounce > 0:
+		co.stop(s)
+		s.pending = data
+		co.start(s, co.opts.debounce)
+
+		return
+	case co.opts.throttle > 0:
+		wait := co.opts.throttle - time.Since(s.lastSent)
+		if wait > 0 || s.timer != nil {
+			s.pending = data
+
+			if s.timer == nil {
+				co.start(s, wait)
+			}
+
+			return
+		}
+
+		s.lastSent = time.Now()
+	}
+
+	co.enqueue(s, data)
+}
+
+// start arms the timer delivering the pending event, the lock must be held.
+func (co *coalescer) start(s *coalesceState, d time.Duration) {
+	gen := s.gen
+	s.timer = time.AfterFunc(d, func() { co.flush(s, gen) })
+}
+
+// stop drops the pending event and its timer, the lock must be held.
+func (co *coalescer) stop(s *coalesceState) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	s.gen++
+	s.pending = nil
+}
+
+func (co *coalescer) flush(s *coalesceState, gen uint64) {
+	co.lock.Lock()
+	defer co.lock.Unlock()
+
+	// a newer event or a released event got here first.
+	if s.gen != gen || s.pending == nil {
+		return
+	}
+
+	data := s.pending
+	s.pending = nil
+	s.timer = nil
+	s.gen++
+	s.lastSent = time.Now()
+
+	co.enqueue(s, data)
+}
+
+// enqueue queues data for delivery, the lock must be held.  With WithLatestOnly the
+// events still waiting are replaced.
+func (co *coalescer) enqueue(s *coalesceState, data []interface{}) {
+	if co.opts.latestOnly {
+		s.queue = append(s.queue[:0], data)
+	} else {
+		s.queue = append(s.queue, data)
+	}
+
+	if !s.running {
+		s.running = true
+
+		go co.drain(s)
+	}
+}
+
+func (co *coalescer) drain(s *coalesceState) {
+	for {
+		co.lock.Lock()
+		if len(s.queue) == 0 {
+			s.running = false
+			co.lock.Unlock()
+
+			return
+		}
+
+		data := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		co.lock.Unlock()
+
+		co.run(data)
+	}
+}
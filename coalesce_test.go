@@ -0,0 +1,167 @@
+package xapi
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the values delivered by a coalescer.
+type recorder struct {
+	lock   sync.Mutex
+	values []string
+	block  chan struct{}
+}
+
+func (r *recorder) run(data []interface{}) {
+	if r.block != nil {
+		<-r.block
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.values = append(r.values, mapField(data, widgetValField).(string))
+}
+
+func (r *recorder) got() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]string(nil), r.values...)
+}
+
+func widgetEvent(id string, typ WidgetEventType, value string) []interface{} {
+	return []interface{}{map[string]interface{}{
+		widgetIDField:   id,
+		widgetTypeField: string(typ),
+		widgetValField:  value,
+	}}
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func waitFor(t *testing.T, r *recorder, want []string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if equalValues(r.got(), want) {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("delivered %v, want %v", r.got(), want)
+}
+
+func TestDebounce(t *testing.T) {
+	r := &recorder{}
+	co := newCoalescer(subscribeOptions{debounce: 30 * time.Millisecond}, r.run)
+
+	for _, v := range []string{"1", "2", "3"} {
+		co.handle(widgetEvent("slider", WidgetChanged, v))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := r.got(); len(got) != 0 {
+		t.Fatalf("delivered %v during the burst", got)
+	}
+
+	waitFor(t, r, []string{"3"})
+
+	time.Sleep(50 * time.Millisecond)
+
+	if got := r.got(); !equalValues(got, []string{"3"}) {
+		t.Fatalf("delivered %v, want only the last event", got)
+	}
+}
+
+func TestDebouncePerWidget(t *testing.T) {
+	r := &recorder{}
+	co := newCoalescer(subscribeOptions{debounce: 20 * time.Millisecond}, r.run)
+
+	co.handle(widgetEvent("a", WidgetChanged, "a1"))
+	co.handle(widgetEvent("b", WidgetChanged, "b1"))
+
+	deadline := time.Now().Add(time.Second)
+	for len(r.got()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := r.got(); len(got) != 2 {
+		t.Fatalf("delivered %v, want one event per widget", got)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	r := &recorder{}
+	co := newCoalescer(subscribeOptions{throttle: 50 * time.Millisecond}, r.run)
+
+	start := time.Now()
+
+	for _, v := range []string{"1", "2", "3"} {
+		co.handle(widgetEvent("slider", WidgetChanged, v))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	waitFor(t, r, []string{"1", "3"})
+
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Fatalf("trailing event delivered after %s, before the interval ended", elapsed)
+	}
+}
+
+func TestLatestOnly(t *testing.T) {
+	r := &recorder{block: make(chan struct{})}
+	co := newCoalescer(subscribeOptions{latestOnly: true}, r.run)
+
+	co.handle(widgetEvent("slider", WidgetChanged, "1"))
+	// let the first delivery start and block.
+	time.Sleep(10 * time.Millisecond)
+
+	for _, v := range []string{"2", "3", "4"} {
+		co.handle(widgetEvent("slider", WidgetChanged, v))
+	}
+
+	close(r.block)
+
+	waitFor(t, r, []string{"1", "4"})
+}
+
+func TestReleasedIsDeliveredLast(t *testing.T) {
+	for _, opts := range []subscribeOptions{
+		{debounce: time.Millisecond},
+		{throttle: time.Millisecond},
+		{throttle: time.Millisecond, latestOnly: true},
+	} {
+		for i := 0; i < 100; i++ {
+			r := &recorder{}
+			co := newCoalescer(opts, r.run)
+
+			co.handle(widgetEvent("slider", WidgetChanged, "1"))
+			co.handle(widgetEvent("slider", WidgetChanged, "2"))
+			time.Sleep(time.Duration(i%3) * 500 * time.Microsecond)
+			co.handle(widgetEvent("slider", WidgetReleased, "final"))
+
+			time.Sleep(5 * time.Millisecond)
+
+			got := r.got()
+			if len(got) == 0 || got[len(got)-1] != "final" {
+				t.Fatalf("%+v: delivered %v, want the released value last", opts, got)
+			}
+		}
+	}
+}
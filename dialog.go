@@ -0,0 +1,290 @@
+package xapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	feedbackIDField = "FeedbackId"
+	feedbackIDBytes = 6
+)
+
+// dialog tracks a single modal dialog (Prompt, TextInput or Rating) on the device.
+// Every dialog gets its own FeedbackId and only sees response events carrying that
+// id, so concurrent flows or other macros on the device can't cross deliver answers.
+// The device only shows one modal dialog at a time so dialogs hold the client's
+// dialog slot from creation till they finish, queueing any overlapping dialogs.
+type dialog struct {
+	c          *Client
+	feedbackID string
+	release    func()
+	once       sync.Once
+	done       chan struct{}
+	lock       sync.Mutex
+	cancels    []func() error
+}
+
+func (c *Client) newDialog(ctx context.Context, kind string) (*dialog, error) {
+	release, err := c.acquireDialog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newFeedbackID(kind)
+	if err != nil {
+		release()
+
+		return nil, err
+	}
+
+	return &dialog{
+		c:          c,
+		feedbackID: id,
+		release:    release,
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// acquireDialog blocks till no other dialog is on the screen or ctx is done.
+func (c *Client) acquireDialog(ctx context.Context) (func(), error) {
+	c.cblock.Lock()
+	slot := c.dialogSlot
+	gone := c.dialogGone
+	c.cblock.Unlock()
+
+	if slot == nil {
+		return nil, ErrNotConnected
+	}
+
+	select {
+	case <-gone:
+		return nil, fmt.Errorf("waiting for dialog: %w", ErrDisconnected)
+	default:
+	}
+
+	select {
+	case slot <- struct{}{}:
+		var once sync.Once
+
+		return func() {
+			once.Do(func() { <-slot })
+		}, nil
+	case <-gone:
+		return nil, fmt.Errorf("waiting for dialog: %w", ErrDisconnected)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for dialog: %w", ctx.Err())
+	}
+}
+
+func newFeedbackID(kind string) (string, error) {
+	b := make([]byte, feedbackIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("feedback id: %w", err)
+	}
+
+	return fmt.Sprintf("go-%s-%s", kind, hex.EncodeToString(b)), nil
+}
+
+// on subscribes to path and calls cb only for events belonging to this dialog.
+func (d *dialog) on(path Path, cb CallbackFunc) error {
+	cancel, err := d.c.Subscribe(path, func(data []interface{}) {
+		if id, _ := mapField(data, feedbackIDField).(string); id == d.feedbackID {
+			cb(data)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	d.cancels = append(d.cancels, cancel)
+	d.lock.Unlock()
+
+	return nil
+}
+
+// watch finishes the dialog when ctx ends or the connection is lost first.  When ctx
+// ends the dialog is removed from the device with the clear command and cb is called
+// with the context error, a lost connection calls cb with ErrDisconnected.
+func (d *dialog) watch(ctx context.Context, clear Command, cb func(error)) {
+	d.c.cblock.Lock()
+	select {
+	case <-d.done:
+	default:
+		if d.c.dialogs != nil {
+			d.c.dialogs[d] = cb
+		}
+	}
+	d.c.cblock.Unlock()
+
+	if ctx.Done() == nil {
+		return
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			d.finish(ctx.Err(), func(err error) {
+				if _, cerr := d.c.sendCommand(clear, map[string]interface{}{
+					feedbackIDField: d.feedbackID,
+				}); cerr != nil {
+					err = multierror.Append(err, cerr)
+				}
+
+				cb(err)
+			})
+		case <-d.done:
+		}
+	}()
+}
+
+// after calls fn once dur has passed, unless the dialog finished before.
+func (d *dialog) after(dur time.Duration, fn func()) {
+	go func() {
+		select {
+		case <-time.After(dur):
+			fn()
+		case <-d.done:
+		}
+	}()
+}
+
+// finish runs cb at most once for the dialog after removing its subscriptions.
+// Any cleanup error is merged into err.
+func (d *dialog) finish(err error, cb func(error)) {
+	d.once.Do(func() {
+		close(d.done)
+
+		if cerr := d.cleanup(); cerr != nil {
+			err = multierror.Append(err, cerr)
+		}
+
+		cb(err)
+	})
+}
+
+// disconnect finishes the dialog with err after its connection was lost.  The
+// subscriptions went away with the connection so cleanup errors are dropped.
+func (d *dialog) disconnect(err error, cb func(error)) {
+	d.once.Do(func() {
+		close(d.done)
+
+		_ = d.cleanup()
+
+		cb(err)
+	})
+}
+
+// abort tears down a dialog that failed to be displayed.
+func (d *dialog) abort(err error) error {
+	d.finish(err, func(merged error) {
+		err = merged
+	})
+
+	return err
+}
+
+func (d *dialog) cleanup() error {
+	defer d.release()
+
+	d.c.cblock.Lock()
+	delete(d.c.dialogs, d)
+	d.c.cblock.Unlock()
+
+	d.lock.Lock()
+	cancels := d.cancels
+	d.cancels = nil
+	d.lock.Unlock()
+
+	var res error
+
+	for _, v := range cancels {
+		if err := v(); err != nil {
+			res = multierror.Append(res, err)
+		}
+	}
+
+	return res
+}
+
+// PromptWait displays a prompt and blocks till the user picks an option, which is
+// returned.  ErrDialogCleared or ErrDialogTimeout is returned when the prompt goes
+// away without an answer.  When ctx ends first the prompt is cleared from the device.
+func (c *Client) PromptWait(ctx context.Context, opts PromptOptions) (string, error) {
+	type result struct {
+		res PromptResult
+		err error
+	}
+
+	ch := make(chan result, 1)
+
+	if err := c.PromptContext(ctx, opts, func(res PromptResult, err error) {
+		ch <- result{res: res, err: err}
+	}); err != nil {
+		return "", err
+	}
+
+	r := <-ch
+
+	switch {
+	case r.err != nil:
+		return "", r.err
+	case r.res.TimedOut:
+		return "", ErrDialogTimeout
+	case r.res.Cleared:
+		return "", ErrDialogCleared
+	}
+
+	return r.res.Option, nil
+}
+
+// TextInputWait displays a text input dialog and blocks till the user submits or
+// cancels it.  When ctx ends first the dialog is cleared from the device.
+func (c *Client) TextInputWait(ctx context.Context, text string, opts ...TextInputOption) (string, bool, error) {
+	type result struct {
+		canceled bool
+		response string
+		err      error
+	}
+
+	ch := make(chan result, 1)
+
+	if err := c.TextInputContext(ctx, text, func(canceled bool, response string, err error) {
+		ch <- result{canceled: canceled, response: response, err: err}
+	}, opts...); err != nil {
+		return "", false, err
+	}
+
+	r := <-ch
+
+	return r.response, r.canceled, r.err
+}
+
+// RatingWait displays a rating dialog and blocks till the user rates or cancels it.
+// When ctx ends first the dialog is cleared from the device.
+func (c *Client) RatingWait(ctx context.Context, title string, text string) (int64, bool, error) {
+	type result struct {
+		canceled bool
+		value    int64
+		err      error
+	}
+
+	ch := make(chan result, 1)
+
+	if err := c.RatingContext(ctx, title, text, func(canceled bool, value int64, err error) {
+		ch <- result{canceled: canceled, value: value, err: err}
+	}); err != nil {
+		return 0, false, err
+	}
+
+	r := <-ch
+
+	return r.value, r.canceled, r.err
+}
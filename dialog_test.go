@@ -0,0 +1,416 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDisconnectFinishesDialogs(t *testing.T) {
+	c, f := newTestClient()
+
+	f.serve(func(string, json.RawMessage) interface{} { return map[string]interface{}{} })
+
+	runErr := make(chan error, 1)
+
+	go func() { runErr <- c.Run() }()
+
+	shown := make(chan error, 1)
+
+	if err := c.Prompt(PromptOptions{Text: "shown", Options: []string{"yes"}}, func(_ PromptResult, err error) {
+		shown <- err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	waiting := make(chan error, 1)
+
+	go func() {
+		_, err := c.PromptWait(context.Background(), PromptOptions{Text: "queued", Options: []string{"yes"}})
+		waiting <- err
+	}()
+
+	// give the second prompt time to block on the dialog slot.
+	time.Sleep(20 * time.Millisecond)
+	f.Close()
+
+	for name, ch := range map[string]chan error{"shown": shown, "waiting": waiting} {
+		select {
+		case err := <-ch:
+			if !errors.Is(err, ErrDisconnected) {
+				t.Fatalf("%s prompt got %v, want ErrDisconnected", name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s prompt still open after the connection was lost", name)
+		}
+	}
+
+	<-runErr
+}
+
+func TestPromptContextGivesUpWaiting(t *testing.T) {
+	c, f := newTestClient()
+
+	f.serve(func(string, json.RawMessage) interface{} { return map[string]interface{}{} })
+
+	go func() { _ = c.Run() }()
+	defer c.Close()
+
+	if err := c.Prompt(PromptOptions{Text: "shown", Options: []string{"yes"}}, func(PromptResult, error) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := c.PromptContext(ctx, PromptOptions{Text: "queued", Options: []string{"yes"}}, func(PromptResult, error) {
+		t.Error("callback of a prompt that was never shown")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("PromptContext returned %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// dialogCall is a command the client sent to the fake device.
+type dialogCall struct {
+	method string
+	params map[string]interface{}
+}
+
+// serveDialogs answers every command with an empty result and reports it on the
+// returned channel.
+func serveDialogs(f *fakeRPC) <-chan dialogCall {
+	calls := make(chan dialogCall, 16)
+
+	f.serve(func(method string, params json.RawMessage) interface{} {
+		var p map[string]interface{}
+		_ = json.Unmarshal(params, &p)
+
+		calls <- dialogCall{method: method, params: p}
+
+		return map[string]interface{}{}
+	})
+
+	return calls
+}
+
+// waitCall returns the next call of method, skipping the subscribes before it.
+func waitCall(t *testing.T, calls <-chan dialogCall, method Command) dialogCall {
+	t.Helper()
+
+	for {
+		select {
+		case call := <-calls:
+			if call.method == string(method) {
+				return call
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s sent", method)
+		}
+	}
+}
+
+// waitShown waits till the device answered the display command and the dialog is
+// shown, ending the context before would abort the display instead.
+func waitShown(t *testing.T, c *Client) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		c.cblock.Lock()
+		n := len(c.dialogs)
+		c.cblock.Unlock()
+
+		if n > 0 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("dialog not shown")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// showPrompt displays a prompt with opts and returns its FeedbackId and the channel
+// its callback reports on.
+func showPrompt(t *testing.T, c *Client, calls <-chan dialogCall, opts PromptOptions) (string, chan promptCallback) {
+	t.Helper()
+
+	ch := make(chan promptCallback, 1)
+
+	if err := c.PromptContext(context.Background(), opts, func(res PromptResult, err error) {
+		ch <- promptCallback{res: res, err: err}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	id, _ := waitCall(t, calls, promptCommand).params[feedbackIDField].(string)
+
+	return id, ch
+}
+
+type promptCallback struct {
+	res PromptResult
+	err error
+}
+
+func waitPrompt(t *testing.T, ch chan promptCallback, wait time.Duration) promptCallback {
+	t.Helper()
+
+	select {
+	case res := <-ch:
+		return res
+	case <-time.After(wait):
+		t.Fatal("prompt callback not called")
+	}
+
+	return promptCallback{}
+}
+
+func promptResponse(id string, option int) string {
+	return fmt.Sprintf(`{"Event":{"UserInterface":{"Message":{"Prompt":{"Response":`+
+		`{"FeedbackId":%q,"OptionId":%d}}}}}}`, id, option)
+}
+
+func promptCleared(id string) string {
+	return fmt.Sprintf(`{"Event":{"UserInterface":{"Message":{"Prompt":{"Cleared":{"FeedbackId":%q}}}}}}`, id)
+}
+
+func TestPromptOptionCount(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	calls := serveDialogs(f)
+
+	go func() { _ = c.Run() }()
+
+	for _, n := range []int{0, optionNumberOfChoices + 1} {
+		opts := PromptOptions{Text: "count", Options: make([]string, n)}
+
+		err := c.PromptContext(context.Background(), opts, func(PromptResult, error) {
+			t.Errorf("callback of a prompt with %d options", n)
+		})
+		if !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%d options returned %v, want ErrInvalidOptions", n, err)
+		}
+	}
+
+	select {
+	case call := <-calls:
+		t.Fatalf("invalid prompt sent %s", call.method)
+	default:
+	}
+
+	for _, n := range []int{1, optionNumberOfChoices} {
+		opts := PromptOptions{Text: "count", Options: make([]string, n)}
+		for i := range opts.Options {
+			opts.Options[i] = fmt.Sprintf("option %d", i+1)
+		}
+
+		id, ch := showPrompt(t, c, calls, opts)
+		f.event(promptResponse(id, n))
+
+		r := waitPrompt(t, ch, time.Second)
+		if r.err != nil || r.res.OptionID != n || r.res.Option != opts.Options[n-1] {
+			t.Errorf("%d options answered %d: %+v, %v", n, n, r.res, r.err)
+		}
+	}
+}
+
+func TestPromptResponse(t *testing.T) {
+	tests := []struct {
+		option int
+		want   string
+		err    error
+	}{
+		{1, "a", nil},
+		{2, "b", nil},
+		{3, "c", nil},
+		{0, "", ErrUnknownResponse},
+		{4, "", ErrUnknownResponse},
+	}
+
+	c, f := newTestClient()
+	defer f.Close()
+
+	calls := serveDialogs(f)
+
+	go func() { _ = c.Run() }()
+
+	for _, tt := range tests {
+		id, ch := showPrompt(t, c, calls, PromptOptions{Text: "pick", Options: []string{"a", "b", "c"}})
+
+		// answers to other dialogs must not finish this one.
+		f.event(promptResponse("other", 1))
+		f.event(promptResponse(id, tt.option))
+
+		r := waitPrompt(t, ch, time.Second)
+
+		if !errors.Is(r.err, tt.err) || (tt.err == nil && r.err != nil) {
+			t.Errorf("option %d returned %v, want %v", tt.option, r.err, tt.err)
+		}
+
+		if r.res.Option != tt.want {
+			t.Errorf("option %d picked %q, want %q", tt.option, r.res.Option, tt.want)
+		}
+	}
+}
+
+func TestPromptCleared(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		timedOut bool
+	}{
+		{"no duration", 0, false},
+		{"before the duration", time.Minute, false},
+		// a prompt cleared within clearedTimeoutSlack of its duration has timed out.
+		{"at the duration", clearedTimeoutSlack, true},
+	}
+
+	c, f := newTestClient()
+	defer f.Close()
+
+	calls := serveDialogs(f)
+
+	go func() { _ = c.Run() }()
+
+	for _, tt := range tests {
+		id, ch := showPrompt(t, c, calls, PromptOptions{Text: tt.name, Options: []string{"a"}, Duration: tt.duration})
+		f.event(promptCleared(id))
+
+		r := waitPrompt(t, ch, time.Second)
+		if r.err != nil || r.res.TimedOut != tt.timedOut || r.res.Cleared == tt.timedOut {
+			t.Errorf("%s: %+v, %v", tt.name, r.res, r.err)
+		}
+	}
+}
+
+func TestPromptTimeoutWithoutEvent(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	calls := serveDialogs(f)
+
+	go func() { _ = c.Run() }()
+
+	_, ch := showPrompt(t, c, calls, PromptOptions{Text: "silent", Options: []string{"a"}, Duration: 10 * time.Millisecond})
+
+	r := waitPrompt(t, ch, time.Second+clearedTimeoutSlack)
+	if r.err != nil || !r.res.TimedOut || r.res.Cleared {
+		t.Fatalf("prompt without a Cleared event: %+v, %v", r.res, r.err)
+	}
+}
+
+func TestPromptWaitErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		event    func(id string) string
+		want     string
+		err      error
+	}{
+		{"answered", 0, func(id string) string { return promptResponse(id, 2) }, "b", nil},
+		{"cleared", time.Minute, promptCleared, "", ErrDialogCleared},
+		{"timed out", clearedTimeoutSlack, promptCleared, "", ErrDialogTimeout},
+	}
+
+	c, f := newTestClient()
+	defer f.Close()
+
+	calls := serveDialogs(f)
+
+	go func() { _ = c.Run() }()
+
+	for _, tt := range tests {
+		type result struct {
+			option string
+			err    error
+		}
+
+		ch := make(chan result, 1)
+
+		go func(d time.Duration) {
+			option, err := c.PromptWait(context.Background(), PromptOptions{Text: "wait", Options: []string{"a", "b"}, Duration: d})
+			ch <- result{option: option, err: err}
+		}(tt.duration)
+
+		id, _ := waitCall(t, calls, promptCommand).params[feedbackIDField].(string)
+		f.event(tt.event(id))
+
+		select {
+		case r := <-ch:
+			if r.option != tt.want || r.err != tt.err {
+				t.Errorf("%s: PromptWait returned %q, %v, want %q, %v", tt.name, r.option, r.err, tt.want, tt.err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: PromptWait still waiting", tt.name)
+		}
+	}
+}
+
+func TestWaitCancelClears(t *testing.T) {
+	tests := []struct {
+		name    string
+		display Command
+		clear   Command
+		wait    func(ctx context.Context, c *Client) error
+	}{
+		{"prompt", promptCommand, promptClearCommand, func(ctx context.Context, c *Client) error {
+			_, err := c.PromptWait(ctx, PromptOptions{Text: "prompt", Options: []string{"a"}})
+
+			return err
+		}},
+		{"text input", textInputCommand, textInputClearCommand, func(ctx context.Context, c *Client) error {
+			_, _, err := c.TextInputWait(ctx, "text input")
+
+			return err
+		}},
+		{"rating", ratingCommand, ratingClearCommand, func(ctx context.Context, c *Client) error {
+			_, _, err := c.RatingWait(ctx, "rating", "text")
+
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, f := newTestClient()
+			defer f.Close()
+
+			calls := serveDialogs(f)
+
+			go func() { _ = c.Run() }()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errc := make(chan error, 1)
+
+			go func() { errc <- tt.wait(ctx, c) }()
+
+			id := waitCall(t, calls, tt.display).params[feedbackIDField]
+			waitShown(t, c)
+			cancel()
+
+			select {
+			case err := <-errc:
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("wait returned %v, want context.Canceled", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("wait still blocked after the context ended")
+			}
+
+			if got := waitCall(t, calls, tt.clear).params[feedbackIDField]; got != id {
+				t.Fatalf("%s sent for %v, want %v", tt.clear, got, id)
+			}
+		})
+	}
+}
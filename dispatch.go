@@ -0,0 +1,188 @@
+package xapi
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+const defaultDispatchWorkers = 8
+
+// DispatchMode picks how event callbacks are run.
+type DispatchMode int
+
+const (
+	// DispatchGoroutine runs every callback in its own goroutine.  Callbacks for the
+	// same subscription may run concurrently and out of order.
+	DispatchGoroutine DispatchMode = iota
+	// DispatchSerial runs the callbacks of each subscription one at a time in the
+	// order the events arrived.  Different subscriptions still run concurrently.
+	DispatchSerial
+	// DispatchPool runs callbacks on a bounded number of workers, set by
+	// Client.DispatchWorkers.
+	DispatchPool
+)
+
+// PanicError is reported to the ErrorHandler when a callback panics.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("callback panic: %v", e.Value)
+}
+
+// executor runs queued funcs on at most limit goroutines.  Queueing never blocks so
+// the run loop can't wait on a slow callback, which could otherwise deadlock a
+// callback waiting on a command response.  When max is set funcs are refused once
+// that many are waiting.
+type executor struct {
+	limit  int
+	max    int
+	lock   sync.Mutex
+	queue  []func()
+	active int
+}
+
+func (e *executor) run(fn func()) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.max > 0 && len(e.queue) >= e.max {
+		return false
+	}
+
+	e.queue = append(e.queue, fn)
+
+	if e.active < e.limit {
+		e.active++
+
+		go e.work()
+	}
+
+	return true
+}
+
+func (e *executor) work() {
+	for {
+		e.lock.Lock()
+		if len(e.queue) == 0 {
+			e.active--
+			e.lock.Unlock()
+
+			return
+		}
+
+		fn := e.queue[0]
+		e.queue[0] = nil
+		e.queue = e.queue[1:]
+		e.lock.Unlock()
+
+		fn()
+	}
+}
+
+// subscription is a single callback subscribed to a path.
+type subscription struct {
+	cb CallbackFunc
+	// serial forces DispatchSerial for this subscription.
+	serial bool
+	// coalesced callbacks trace and recover the wrapped callback themselves, so
+	// the coalescer is called directly instead of adding a second span.
+	coalesced bool
+	// inline runs the callback on the run loop, see withInlineDelivery.
+	inline bool
+}
+
+// subscribeState is the outcome of the device subscribe for a path, shared by every
+// subscriber that joined while it was in flight.  err is set before done is closed.
+type subscribeState struct {
+	done chan struct{}
+	err  error
+}
+
+// dispatch runs a callback for subscription id according to the dispatch mode.
+// ErrDispatchQueueFull is returned when the event had to be dropped.
+func (c *Client) dispatch(id uint64, path Path, sub *subscription, data []interface{}) error {
+	fn := func() {
+		c.safeCallback(path, sub.cb, data)
+	}
+
+	if sub.coalesced {
+		fn = func() {
+			sub.cb(data)
+		}
+	}
+
+	if sub.inline {
+		fn()
+
+		return nil
+	}
+
+	mode := c.Dispatch
+	if sub.serial {
+		mode = DispatchSerial
+	}
+
+	var e *executor
+
+	switch mode {
+	case DispatchSerial:
+		c.cblock.Lock()
+		if c.serialQueues == nil {
+			c.serialQueues = make(map[uint64]*executor)
+		}
+
+		var ok bool
+
+		e, ok = c.serialQueues[id]
+		if !ok {
+			e = &executor{limit: 1, max: c.DispatchQueueSize}
+			c.serialQueues[id] = e
+		}
+		c.cblock.Unlock()
+	case DispatchPool:
+		c.cblock.Lock()
+		if c.pool == nil {
+			workers := c.DispatchWorkers
+			if workers <= 0 {
+				workers = defaultDispatchWorkers
+			}
+
+			c.pool = &executor{limit: workers, max: c.DispatchQueueSize}
+		}
+		e = c.pool
+		c.cblock.Unlock()
+	default:
+		go fn()
+
+		return nil
+	}
+
+	if !e.run(fn) {
+		c.metrics().EventDropped(ErrDispatchQueueFull)
+
+		return fmt.Errorf("callback %s: %w", path, ErrDispatchQueueFull)
+	}
+
+	return nil
+}
+
+// safeCallback runs a callback reporting any panic to the ErrorHandler instead of
+// crashing the process.  The run loop can't be stopped from a callback so the
+// ErrorHandler result is ignored.
+func (c *Client) safeCallback(path Path, cb CallbackFunc, data []interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			_ = c.loopError(&LoopError{
+				Op:      OpCallback,
+				Payload: string(path),
+				Err:     &PanicError{Value: r, Stack: debug.Stack()},
+			})
+		}
+	}()
+
+	c.runCallback(path, cb, data)
+}
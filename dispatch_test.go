@@ -0,0 +1,106 @@
+package xapi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExecutorRefusesWhenFull(t *testing.T) {
+	e := &executor{limit: 1, max: 2}
+	block := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	if !e.run(func() { <-block; wg.Done() }) {
+		t.Fatal("first func refused")
+	}
+
+	// wait for the worker to take the blocking func off the queue.
+	for {
+		e.lock.Lock()
+		n := len(e.queue)
+		e.lock.Unlock()
+
+		if n == 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		if !e.run(wg.Done) {
+			t.Fatalf("func %d refused below max", i)
+		}
+	}
+
+	if e.run(func() {}) {
+		t.Fatal("func accepted above max")
+	}
+
+	close(block)
+	wg.Wait()
+}
+
+func TestSerialDispatchKeepsOrder(t *testing.T) {
+	c, _ := newTestClient()
+	c.Dispatch = DispatchSerial
+
+	var (
+		lock sync.Mutex
+		got  []int
+		wg   sync.WaitGroup
+	)
+
+	const n = 100
+
+	wg.Add(n)
+
+	cb := func(data []interface{}) {
+		lock.Lock()
+		got = append(got, data[0].(int))
+		lock.Unlock()
+		wg.Done()
+	}
+
+	for i := 0; i < n; i++ {
+		if err := c.dispatch(1, Event, &subscription{cb: cb}, []interface{}{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wg.Wait()
+
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("event %d delivered as %d", i, v)
+		}
+	}
+}
+
+func TestDispatchQueueFull(t *testing.T) {
+	c, _ := newTestClient()
+	c.Dispatch = DispatchSerial
+	c.DispatchQueueSize = 1
+
+	block := make(chan struct{})
+	defer close(block)
+
+	cb := func([]interface{}) { <-block }
+
+	var full error
+
+	for i := 0; i < 5 && full == nil; i++ {
+		full = c.dispatch(1, Event, &subscription{cb: cb}, nil)
+	}
+
+	if !errors.Is(full, ErrDispatchQueueFull) {
+		t.Fatalf("dispatch returned %v, want ErrDispatchQueueFull", full)
+	}
+}
@@ -3,23 +3,151 @@ package xapi
 import (
 	"errors"
 	"fmt"
+	"strings"
+)
+
+// JSON-RPC error codes sent by the Webex device.
+const (
+	codeCommandError   = 1
+	codeIllegalValue   = 2
+	codeInvalidPath    = 3
+	codeParameterError = 4
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
 )
 
 // JSONRPCError represents the JsonRPC2 Error message in a more golang
-// friendly way rather than just a response type.
+// friendly way rather than just a response type.  Known error codes match
+// the sentinel errors such as ErrPathNotFound with errors.Is.
 type JSONRPCError struct {
 	Code    float64
 	Data    interface{}
 	Message string
+	// Reason is the xAPI reason for the error from Data, if the device sent one.
+	Reason string
+	// XPath is the xAPI path the error refers to from Data, if the device sent one.
+	XPath string
+}
+
+func newJSONRPCError(code float64, message string, data interface{}) JSONRPCError {
+	e := JSONRPCError{
+		Code:    code,
+		Data:    data,
+		Message: message,
+	}
+
+	if m, ok := data.(map[string]interface{}); ok {
+		e.Reason = xapiReason(m)
+		e.XPath = stringField(m, "XPath")
+	}
+
+	return e
 }
 
 func (e JSONRPCError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("error code: %v, %v: %v", e.Code, e.Message, e.Reason)
+	}
+
 	return fmt.Sprintf("error code: %v, %v", e.Code, e.Message)
 }
 
+// Is reports if the error code corresponds to target.  No code maps to ErrUnauthorized:
+// the device checks the login when the WebSocket is opened and refuses the handshake
+// with 401 or 403, which Connect reports as ErrUnauthorized, and there is no
+// documented JSON-RPC code for commands the user role may not run.
+func (e JSONRPCError) Is(target error) bool {
+	switch target {
+	case ErrCommandFailed:
+		return e.Code == codeCommandError
+	case ErrInvalidParams:
+		return e.Code == codeInvalidParams || e.Code == codeParameterError || e.Code == codeIllegalValue
+	case ErrPathNotFound:
+		return e.Code == codeInvalidPath
+	case ErrMethodNotFound:
+		return e.Code == codeMethodNotFound
+	}
+
+	return false
+}
+
+// CommandError is returned when the device accepts a command but reports that
+// running it failed.  It matches ErrCommandFailed with errors.Is.
+type CommandError struct {
+	Command Command
+	Reason  string
+	Result  map[string]interface{}
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s: command failed: %s", e.Command, e.Reason)
+}
+
+// Is reports if target is ErrCommandFailed.
+func (e *CommandError) Is(target error) bool {
+	return target == ErrCommandFailed
+}
+
+// commandError returns a CommandError when res is an xAPI command result with
+// an error status.  Only xCommand results are checked, other results such as a
+// status branch read with Get can hold a Status leaf of their own.
+func commandError(command Command, res map[string]interface{}) error {
+	if !strings.HasPrefix(string(command), commandPrefix+"/") {
+		return nil
+	}
+
+	status, ok := res["status"].(string)
+	if !ok {
+		status, _ = res["Status"].(string)
+	}
+
+	if !strings.EqualFold(status, "Error") {
+		return nil
+	}
+
+	return &CommandError{
+		Command: command,
+		Reason:  xapiReason(res),
+		Result:  res,
+	}
+}
+
+// xapiReason digs the reason out of an xAPI error body.  Depending on the firmware it
+// is either a plain Reason field, or nested as a Value inside Reason or Error.
+func xapiReason(m map[string]interface{}) string {
+	for _, k := range []string{"Reason", "Error"} {
+		switch v := m[k].(type) {
+		case string:
+			return v
+		case map[string]interface{}:
+			if r := xapiReason(v); r != "" {
+				return r
+			}
+
+			if r := stringField(v, "Value"); r != "" {
+				return r
+			}
+		}
+	}
+
+	return ""
+}
+
 var (
-	// ErrInvalidCredentials is returned when authentication fails.
+	// ErrInvalidCredentials is returned when the login or password is missing.
 	ErrInvalidCredentials = errors.New("missing login or password")
+	// ErrUnauthorized is returned when the device rejects the login or password.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrMethodNotFound is returned when the device does not know the command.
+	ErrMethodNotFound = errors.New("method not found")
+	// ErrInvalidParams is returned when the parameters or values of a command are rejected.
+	ErrInvalidParams = errors.New("invalid params")
+	// ErrPathNotFound is returned when a path does not exist on the device.
+	ErrPathNotFound = errors.New("path not found")
+	// ErrInvalidPath is returned for malformed paths.
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrCommandFailed is returned when the device fails to run a command.
+	ErrCommandFailed = errors.New("command failed")
 	// ErrMissingChannel is returned when a response channel is not found for
 	// a response that comes in.  This should not happen unless a channel is removed
 	// due to timeout and the message comes in late.
@@ -30,12 +158,16 @@ var (
 	// ErrNotConnected happens when you try and perform client operations without calling
 	// one of the connect methods.
 	ErrNotConnected = errors.New("not connected")
+	// ErrDisconnected is returned to requests still waiting for a response when the
+	// connection to the device is lost.
+	ErrDisconnected = errors.New("disconnected")
 	// ErrInvalidMsg is returned when an invalid json message type is received from the Webex device.
 	ErrInvalidMsg = errors.New("invalid message")
-	// ErrUnknownResponse is returned when a jsonrpc2 response comes in with an unknown data type.
+	// ErrUnknownResponse is returned when a response or event from the device does not have the
+	// expected content.
 	ErrUnknownResponse = errors.New("unknown response")
-	// ErrUnsupportedMsg is returned when a unhandled jsonrpc2 occurs.  Currently this only happens
-	// when a jsonrpc2 Request Message comes in from the server.
+	// ErrUnsupportedMsg is returned when a unhandled jsonrpc2 occurs.  Requests from the server are
+	// answered through HandleMethod so this is currently not returned.
 	ErrUnsupportedMsg = errors.New("unsupported jsonrpc2 message")
 	// ErrMissingData is returned when we parse the response json struct for the jpath and
 	// it returns nothing.
@@ -43,4 +175,25 @@ var (
 	// ErrMissingCallback is returned when we find a response in the callback tree but its missing
 	// I don't think would ever happen in the real world.
 	ErrMissingCallback = errors.New("missing callback")
+	// ErrInvalidOptions is returned when a dialog is given too few or too many options.
+	ErrInvalidOptions = errors.New("invalid number of options")
+	// ErrDialogCleared is returned by the blocking dialogs when the user dismisses the dialog.
+	ErrDialogCleared = errors.New("dialog cleared")
+	// ErrDialogTimeout is returned by the blocking dialogs when the dialog times out.
+	ErrDialogTimeout = errors.New("dialog timed out")
+	// ErrFlowCanceled is returned from Flow.Run when the user cancels one of its dialogs.
+	ErrFlowCanceled = errors.New("flow canceled")
+	// ErrUnknownStep is returned from Flow.Run when a step branches to a step that does not exist.
+	ErrUnknownStep = errors.New("unknown flow step")
+	// ErrMacroNotFound is returned when a macro does not exist on the device.
+	ErrMacroNotFound = errors.New("macro not found")
+	// ErrUnexpectedType is returned by the typed getters when a value can't be converted.
+	ErrUnexpectedType = errors.New("unexpected value type")
+	// ErrDispatchQueueFull is reported when an event is dropped because too many callbacks
+	// are already waiting to run, see Client.DispatchQueueSize.
+	ErrDispatchQueueFull = errors.New("dispatch queue full")
+	// ErrUnknownWidget is returned when updating a widget that has not been bound.
+	ErrUnknownWidget = errors.New("unknown widget")
+	// ErrInvalidRange is returned when a slider is bound with a max that is not above its min.
+	ErrInvalidRange = errors.New("invalid range")
 )
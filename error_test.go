@@ -0,0 +1,124 @@
+package xapi
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestNewJSONRPCError(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   interface{}
+		reason string
+		xpath  string
+	}{
+		{"no data", nil, "", ""},
+		{"plain reason", map[string]interface{}{"Reason": "No match", "XPath": "/Status/Foo"}, "No match", "/Status/Foo"},
+		{"reason value", map[string]interface{}{"Reason": map[string]interface{}{"Value": "Bad value"}}, "Bad value", ""},
+		{"nested error", map[string]interface{}{"Error": map[string]interface{}{"Reason": "Deep"}}, "Deep", ""},
+		{"error value", map[string]interface{}{"Error": map[string]interface{}{"Value": "Failed"}}, "Failed", ""},
+		{"not an object", "oops", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newJSONRPCError(codeInvalidPath, "msg", tt.data)
+
+			if e.Reason != tt.reason || e.XPath != tt.xpath {
+				t.Fatalf("reason %q xpath %q, want %q %q", e.Reason, e.XPath, tt.reason, tt.xpath)
+			}
+
+			if e.Code != codeInvalidPath || e.Message != "msg" {
+				t.Fatalf("code %v message %q", e.Code, e.Message)
+			}
+		})
+	}
+}
+
+func TestJSONRPCErrorIs(t *testing.T) {
+	sentinels := []error{ErrCommandFailed, ErrInvalidParams, ErrPathNotFound, ErrMethodNotFound, ErrUnauthorized}
+
+	tests := []struct {
+		code float64
+		want error
+	}{
+		{codeCommandError, ErrCommandFailed},
+		{codeIllegalValue, ErrInvalidParams},
+		{codeInvalidPath, ErrPathNotFound},
+		{codeParameterError, ErrInvalidParams},
+		{codeMethodNotFound, ErrMethodNotFound},
+		{codeInvalidParams, ErrInvalidParams},
+		{-32000, nil},
+	}
+
+	for _, tt := range tests {
+		var err error = newJSONRPCError(tt.code, "msg", nil)
+
+		for _, s := range sentinels {
+			if got := errors.Is(err, s); got != (s == tt.want) {
+				t.Errorf("code %v: errors.Is(%v) = %v", tt.code, s, got)
+			}
+		}
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	tests := []struct {
+		name    string
+		command Command
+		res     map[string]interface{}
+		reason  string
+		failed  bool
+	}{
+		{"ok", alertCommand, map[string]interface{}{"status": "OK"}, "", false},
+		{"no status", alertCommand, map[string]interface{}{}, "", false},
+		{"error", alertCommand, map[string]interface{}{"status": "Error", "Reason": "Busy"}, "Busy", true},
+		{"capital status", NewCommand("Dial"), map[string]interface{}{"Status": "error",
+			"Error": map[string]interface{}{"Value": "Invalid"}}, "Invalid", true},
+		{"status branch", getCommand, map[string]interface{}{"Status": "Error"}, "", false},
+		{"set", setCommand, map[string]interface{}{"status": "Error"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := commandError(tt.command, tt.res)
+			if !tt.failed {
+				if err != nil {
+					t.Fatalf("commandError returned %v", err)
+				}
+
+				return
+			}
+
+			var cerr *CommandError
+			if !errors.As(err, &cerr) || !errors.Is(err, ErrCommandFailed) {
+				t.Fatalf("commandError returned %v, want a CommandError", err)
+			}
+
+			if cerr.Reason != tt.reason || cerr.Command != tt.command {
+				t.Fatalf("reason %q command %s", cerr.Reason, cerr.Command)
+			}
+		})
+	}
+}
+
+func TestGetStatusBranchNamedStatus(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	f.serve(func(string, json.RawMessage) interface{} {
+		return map[string]interface{}{"Status": "Error", "Error": map[string]interface{}{"Reason": "offline"}}
+	})
+
+	go func() { _ = c.Run() }()
+
+	v, err := c.Get("Status Webex")
+	if err != nil {
+		t.Fatalf("Get returned %v", err)
+	}
+
+	if m, ok := v.(map[string]interface{}); !ok || m["Status"] != "Error" {
+		t.Fatalf("Get returned %v", v)
+	}
+}
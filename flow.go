@@ -0,0 +1,255 @@
+package xapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// FlowEnd can be returned from FlowStep.Next to finish the flow early.
+const FlowEnd = "<end>"
+
+// FlowStepKind is the type of dialog a FlowStep shows.
+type FlowStepKind int
+
+const (
+	// FlowTextInput asks for free form text with TextInput.
+	FlowTextInput FlowStepKind = iota
+	// FlowChoice asks the user to pick one of the step Options with Prompt.
+	FlowChoice
+	// FlowRating asks for a '5 star' rating with Rating.
+	FlowRating
+	// FlowAlert displays an Alert, such as a confirmation at the end of a flow.  It
+	// does not wait for the user and its answer is always empty.
+	FlowAlert
+)
+
+// FlowStep is a single dialog in a Flow.
+type FlowStep struct {
+	// Name identifies the step.  Its answer is stored under this name in FlowResult
+	// and it is what Next returns to branch to this step.
+	Name string
+	Kind FlowStepKind
+	// Title and Text of the dialog.
+	Title string
+	Text  string
+	// Options to pick from for FlowChoice steps.
+	Options []string
+	// InputOptions for FlowTextInput steps.
+	InputOptions []TextInputOption
+	// Validate checks the answer of a FlowTextInput step.  When it returns an error the
+	// dialog is shown again with the error as its title.
+	Validate func(string) error
+	// Timeout for the user to answer this step, zero waits forever.  For FlowAlert
+	// steps this is how long the alert is displayed.
+	Timeout time.Duration
+	// Next picks the step to go to from the answer.  When nil or when it returns an
+	// empty string the flow continues with the following step, FlowEnd finishes it.
+	Next func(answer string, res *FlowResult) string
+}
+
+// Flow is a sequence of dialogs shown one after the other on the touch panel, such as
+// a short survey or a form.
+type Flow struct {
+	Steps []FlowStep
+	// BackText, when set, adds an option with this text to every FlowChoice step
+	// that has a previous step.  Picking it goes back to the previous step.
+	BackText string
+}
+
+// validate checks the options of the FlowChoice steps, including the back option
+// that may be added to them.
+func (f *Flow) validate() error {
+	for _, v := range f.Steps {
+		if v.Kind != FlowChoice {
+			continue
+		}
+
+		max := optionNumberOfChoices
+		if f.BackText != "" {
+			max--
+		}
+
+		if len(v.Options) < 1 || len(v.Options) > max {
+			return fmt.Errorf("flow step %s with %d options: %w", v.Name, len(v.Options), ErrInvalidOptions)
+		}
+
+		for _, o := range v.Options {
+			if f.BackText != "" && o == f.BackText {
+				return fmt.Errorf("flow step %s option %q is the back text: %w", v.Name, o, ErrInvalidOptions)
+			}
+		}
+	}
+
+	return nil
+}
+
+// FlowResult holds the answers of a flow keyed by step name.  Ratings are stored
+// as their decimal string.  Visited lists the answered steps in order, FlowAlert
+// steps are not answered and not listed.
+type FlowResult struct {
+	Answers map[string]string
+	Visited []string
+}
+
+// Run shows the flow on the device and blocks till it finishes.  ErrFlowCanceled is
+// returned when the user dismisses or cancels one of the dialogs and ErrDialogTimeout
+// when a step times out.  The answers so far are returned with any error.
+// ErrInvalidOptions is returned before anything is shown when a FlowChoice step has
+// no options, more than fit next to the back option, or an option equal to BackText.
+func (f *Flow) Run(ctx context.Context, c *Client) (*FlowResult, error) {
+	res := &FlowResult{Answers: make(map[string]string)}
+
+	if err := f.validate(); err != nil {
+		return res, err
+	}
+
+	index := make(map[string]int, len(f.Steps))
+	for i, v := range f.Steps {
+		index[v.Name] = i
+	}
+
+	var history []int
+
+	for i := 0; i < len(f.Steps); {
+		step := f.Steps[i]
+
+		answer, back, err := f.runStep(ctx, c, step, len(history) > 0)
+		if err != nil {
+			return res, fmt.Errorf("flow step %s: %w", step.Name, err)
+		}
+
+		if back {
+			i = history[len(history)-1]
+			history = history[:len(history)-1]
+			res.Visited = res.Visited[:len(res.Visited)-1]
+			delete(res.Answers, f.Steps[i].Name)
+
+			continue
+		}
+
+		res.Answers[step.Name] = answer
+
+		// an alert can't be gone back to, going back skips over it.
+		if step.Kind != FlowAlert {
+			res.Visited = append(res.Visited, step.Name)
+			history = append(history, i)
+		}
+
+		next := ""
+		if step.Next != nil {
+			next = step.Next(answer, res)
+		}
+
+		switch next {
+		case "":
+			i++
+		case FlowEnd:
+			return res, nil
+		default:
+			n, ok := index[next]
+			if !ok {
+				return res, fmt.Errorf("flow step %s: %s: %w", step.Name, next, ErrUnknownStep)
+			}
+
+			i = n
+		}
+	}
+
+	return res, nil
+}
+
+func (f *Flow) runStep(ctx context.Context, c *Client, step FlowStep, canGoBack bool) (string, bool, error) {
+	if step.Kind == FlowAlert {
+		_, err := c.Alert(step.Title, step.Text, step.Timeout)
+
+		return "", false, err
+	}
+
+	stepCtx := ctx
+
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		stepCtx, cancel = context.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+
+	answer, back, err := f.ask(stepCtx, c, step, canGoBack)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return "", false, ErrDialogTimeout
+	}
+
+	return answer, back, err
+}
+
+func (f *Flow) ask(ctx context.Context, c *Client, step FlowStep, canGoBack bool) (string, bool, error) {
+	switch step.Kind {
+	case FlowTextInput:
+		opts := step.InputOptions
+		if step.Title != "" {
+			opts = append(opts[:len(opts):len(opts)], WithTitle(step.Title))
+		}
+
+		for {
+			text, canceled, err := c.TextInputWait(ctx, step.Text, opts...)
+			if err != nil {
+				return "", false, err
+			}
+
+			if canceled {
+				return "", false, ErrFlowCanceled
+			}
+
+			if step.Validate == nil {
+				return text, false, nil
+			}
+
+			verr := step.Validate(text)
+			if verr == nil {
+				return text, false, nil
+			}
+
+			opts = append(opts[:len(opts):len(opts)], WithTitle(verr.Error()))
+		}
+
+	case FlowChoice:
+		opts := PromptOptions{
+			Title:   step.Title,
+			Text:    step.Text,
+			Options: step.Options,
+		}
+
+		back := canGoBack && f.BackText != ""
+		if back {
+			opts.Options = append(opts.Options[:len(opts.Options):len(opts.Options)], f.BackText)
+		}
+
+		choice, err := c.PromptWait(ctx, opts)
+		if errors.Is(err, ErrDialogCleared) {
+			return "", false, ErrFlowCanceled
+		}
+
+		if err != nil {
+			return "", false, err
+		}
+
+		return choice, back && choice == f.BackText, nil
+
+	case FlowRating:
+		value, canceled, err := c.RatingWait(ctx, step.Title, step.Text)
+		if err != nil {
+			return "", false, err
+		}
+
+		if canceled {
+			return "", false, ErrFlowCanceled
+		}
+
+		return strconv.FormatInt(value, 10), false, nil
+	}
+
+	return "", false, fmt.Errorf("kind %d: %w", step.Kind, ErrUnknownStep)
+}
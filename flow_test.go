@@ -0,0 +1,100 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFlowValidate(t *testing.T) {
+	five := []string{"1", "2", "3", "4", "5"}
+
+	tests := []struct {
+		name string
+		flow Flow
+		ok   bool
+	}{
+		{"five options", Flow{Steps: []FlowStep{{Kind: FlowChoice, Options: five}}}, true},
+		{"no options", Flow{Steps: []FlowStep{{Kind: FlowChoice}}}, false},
+		{"five options and back", Flow{BackText: "Back", Steps: []FlowStep{{Kind: FlowChoice, Options: five}}}, false},
+		{"four options and back", Flow{BackText: "Back", Steps: []FlowStep{{Kind: FlowChoice, Options: five[:4]}}}, true},
+		{"option is back text", Flow{BackText: "1", Steps: []FlowStep{{Kind: FlowChoice, Options: five[:2]}}}, false},
+		{"text input", Flow{BackText: "Back", Steps: []FlowStep{{Kind: FlowTextInput}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.flow.validate()
+			if tt.ok && err != nil {
+				t.Fatalf("validate returned %v", err)
+			}
+
+			if !tt.ok && !errors.Is(err, ErrInvalidOptions) {
+				t.Fatalf("validate returned %v, want ErrInvalidOptions", err)
+			}
+		})
+	}
+}
+
+func TestFlowBackSkipsAlert(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	// answers picks the option for each prompt shown, in order.
+	answers := []string{"a", "Back", "a", "b"}
+
+	var shown []string
+
+	f.serve(func(method string, params json.RawMessage) interface{} {
+		if method != string(promptCommand) {
+			return map[string]interface{}{}
+		}
+
+		var p map[string]interface{}
+		_ = json.Unmarshal(params, &p)
+
+		shown = append(shown, p[textField].(string))
+		want := answers[0]
+		answers = answers[1:]
+
+		for i := 1; i <= optionNumberOfChoices; i++ {
+			if p[fmt.Sprintf("Option.%d", i)] == want {
+				f.event(fmt.Sprintf(`{"Event":{"UserInterface":{"Message":{"Prompt":{"Response":`+
+					`{"FeedbackId":%q,"OptionId":%d}}}}}}`, p[feedbackIDField], i))
+			}
+		}
+
+		return map[string]interface{}{}
+	})
+
+	go func() { _ = c.Run() }()
+
+	flow := Flow{
+		BackText: "Back",
+		Steps: []FlowStep{
+			{Name: "first", Kind: FlowChoice, Text: "first", Options: []string{"a"}},
+			{Name: "note", Kind: FlowAlert, Text: "note"},
+			{Name: "second", Kind: FlowChoice, Text: "second", Options: []string{"b"}},
+		},
+	}
+
+	res, err := flow.Run(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"first", "second", "first", "second"}; !reflect.DeepEqual(shown, want) {
+		t.Errorf("prompts shown %v, want %v", shown, want)
+	}
+
+	if want := []string{"first", "second"}; !reflect.DeepEqual(res.Visited, want) {
+		t.Errorf("visited %v, want %v", res.Visited, want)
+	}
+
+	if res.Answers["first"] != "a" || res.Answers["second"] != "b" {
+		t.Errorf("answers %v", res.Answers)
+	}
+}
@@ -0,0 +1,120 @@
+package xapi
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GetString retrieves a value and converts it to a string.  Numbers and booleans
+// are formatted, objects and lists return an error.
+func (c *Client) GetString(path Path) (string, error) {
+	v, err := c.Get(path)
+	if err != nil {
+		return "", err
+	}
+
+	return stringValue(path, v)
+}
+
+// GetFloat retrieves a value and converts it to a float64.  Numeric strings are parsed.
+func (c *Client) GetFloat(path Path) (float64, error) {
+	v, err := c.Get(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return floatValue(path, v)
+}
+
+// GetInt retrieves a value and converts it to an int64.  Numbers with a fraction
+// return an error.
+func (c *Client) GetInt(path Path) (int64, error) {
+	v, err := c.Get(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return intValue(path, v)
+}
+
+// GetBool retrieves a value and converts it to a bool.  Besides JSON booleans the
+// device values On/Off, True/False and Yes/No are understood, as are 1 and 0.
+func (c *Client) GetBool(path Path) (bool, error) {
+	v, err := c.Get(path)
+	if err != nil {
+		return false, err
+	}
+
+	return boolValue(path, v)
+}
+
+func stringValue(path Path, v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	default:
+		return "", typeError(path, v, "string")
+	}
+}
+
+func floatValue(path Path, v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return 0, typeError(path, v, "float")
+		}
+
+		return f, nil
+	default:
+		return 0, typeError(path, v, "float")
+	}
+}
+
+func intValue(path Path, v interface{}) (int64, error) {
+	f, err := floatValue(path, v)
+	if err != nil {
+		return 0, err
+	}
+
+	if f != math.Trunc(f) || f > math.MaxInt64 || f < math.MinInt64 {
+		return 0, typeError(path, v, "int")
+	}
+
+	return int64(f), nil
+}
+
+func boolValue(path Path, v interface{}) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case float64:
+		switch x {
+		case 0:
+			return false, nil
+		case 1:
+			return true, nil
+		}
+	case string:
+		switch strings.ToLower(strings.TrimSpace(x)) {
+		case "on", "true", "yes", "1":
+			return true, nil
+		case "off", "false", "no", "0":
+			return false, nil
+		}
+	}
+
+	return false, typeError(path, v, "bool")
+}
+
+func typeError(path Path, v interface{}, want string) error {
+	return fmt.Errorf("%s: %T %v is not a %s: %w", path, v, v, want, ErrUnexpectedType)
+}
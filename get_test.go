@@ -0,0 +1,145 @@
+package xapi
+
+import (
+	"errors"
+	"testing"
+)
+
+const testGetPath Path = "Status Audio Volume"
+
+func TestStringValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+		err  bool
+	}{
+		{"Standby", "Standby", false},
+		{float64(50), "50", false},
+		{1.5, "1.5", false},
+		{true, "true", false},
+		{map[string]interface{}{}, "", true},
+		{[]interface{}{}, "", true},
+		{nil, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := stringValue(testGetPath, tt.in)
+		if checkTypeError(t, tt.in, err, tt.err) {
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("stringValue(%#v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFloatValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want float64
+		err  bool
+	}{
+		{float64(50), 50, false},
+		{"50", 50, false},
+		{" -2.5 ", -2.5, false},
+		{"1e3", 1000, false},
+		{"Off", 0, true},
+		{"", 0, true},
+		{true, 0, true},
+		{nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := floatValue(testGetPath, tt.in)
+		if checkTypeError(t, tt.in, err, tt.err) {
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("floatValue(%#v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIntValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want int64
+		err  bool
+	}{
+		{float64(50), 50, false},
+		{"50", 50, false},
+		{"-3", -3, false},
+		{"2.0", 2, false},
+		{1.5, 0, true},
+		{"0.25", 0, true},
+		{1e300, 0, true},
+		{"On", 0, true},
+		{false, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := intValue(testGetPath, tt.in)
+		if checkTypeError(t, tt.in, err, tt.err) {
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("intValue(%#v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBoolValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want bool
+		err  bool
+	}{
+		{true, true, false},
+		{false, false, false},
+		{"On", true, false},
+		{"Off", false, false},
+		{"True", true, false},
+		{"False", false, false},
+		{"Yes", true, false},
+		{"No", false, false},
+		{" on ", true, false},
+		{"1", true, false},
+		{"0", false, false},
+		{float64(1), true, false},
+		{float64(0), false, false},
+		{float64(2), false, true},
+		{"Maybe", false, true},
+		{nil, false, true},
+	}
+
+	for _, tt := range tests {
+		got, err := boolValue(testGetPath, tt.in)
+		if checkTypeError(t, tt.in, err, tt.err) {
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("boolValue(%#v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// checkTypeError reports whether err was expected, failing the test when it does
+// not match or does not wrap ErrUnexpectedType.
+func checkTypeError(t *testing.T, in interface{}, err error, want bool) bool {
+	t.Helper()
+
+	switch {
+	case want && err == nil:
+		t.Errorf("%#v: no error", in)
+	case want && !errors.Is(err, ErrUnexpectedType):
+		t.Errorf("%#v: %v does not wrap ErrUnexpectedType", in, err)
+	case !want && err != nil:
+		t.Errorf("%#v: %v", in, err)
+	}
+
+	return want || err != nil
+}
@@ -0,0 +1,102 @@
+package xapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/c0mm4nd/go-jsonrpc2"
+)
+
+const (
+	codeInternalError = -32603
+)
+
+// MethodHandler answers a JSON-RPC request sent by the device.  The result is
+// marshaled to JSON for the response.  Returning a JSONRPCError sets the error
+// code of the response, any other error is sent as an internal error.
+type MethodHandler func(params json.RawMessage) (interface{}, error)
+
+// HandleMethod registers handler for requests the device sends for method.  Requests
+// for methods without a handler are answered with a method not found error.
+// Registering a nil handler removes it.  Handlers are kept across reconnects.
+func (c *Client) HandleMethod(method string, handler MethodHandler) {
+	c.hlock.Lock()
+	defer c.hlock.Unlock()
+
+	if c.handlers == nil {
+		c.handlers = make(map[string]MethodHandler)
+	}
+
+	if handler == nil {
+		delete(c.handlers, method)
+
+		return
+	}
+
+	c.handlers[method] = handler
+}
+
+// handleRequest answers a request from the device in the background so a slow
+// handler does not hold up the run loop.
+func (c *Client) handleRequest(msg *jsonrpc2.JsonRpcMessage) {
+	c.hlock.Lock()
+	handler, ok := c.handlers[msg.Method]
+	c.hlock.Unlock()
+
+	go func() {
+		var resp *jsonrpc2.JsonRpcMessage
+
+		if !ok {
+			c.log().Warn("request for unhandled method", "method", msg.Method)
+			resp = jsonrpc2.NewJsonRpcError(msg.ID, jsonrpc2.NewError(0, jsonrpc2.ErrMethodNotFound))
+		} else {
+			resp = c.runHandler(msg, handler)
+		}
+
+		if err := c.write(resp); err != nil {
+			c.log().Error("request response failed", "method", msg.Method, "error", err)
+		}
+	}()
+}
+
+// runHandler runs handler for the request and builds the response.  A panic in the
+// handler is reported to the ErrorHandler and answered with an internal error.
+func (c *Client) runHandler(msg *jsonrpc2.JsonRpcMessage, handler MethodHandler) (resp *jsonrpc2.JsonRpcMessage) {
+	var params json.RawMessage
+	if msg.Params != nil {
+		params = *msg.Params
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = c.loopError(newLoopError(OpHandler, msg, &PanicError{Value: r, Stack: debug.Stack()}))
+			// the panic value stays local, the device only learns the handler failed.
+			resp = jsonrpc2.NewJsonRpcError(msg.ID, jsonrpc2.NewError(codeInternalError,
+				fmt.Errorf("handler %s panicked", msg.Method)))
+		}
+	}()
+
+	res, err := handler(params)
+	if err != nil {
+		var rpcErr JSONRPCError
+		if errors.As(err, &rpcErr) {
+			return jsonrpc2.NewJsonRpcError(msg.ID, &jsonrpc2.Error{
+				Code:    int(rpcErr.Code),
+				Message: rpcErr.Message,
+				Data:    rpcErr.Data,
+			})
+		}
+
+		return jsonrpc2.NewJsonRpcError(msg.ID, jsonrpc2.NewError(codeInternalError, err))
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return jsonrpc2.NewJsonRpcError(msg.ID, jsonrpc2.NewError(codeInternalError,
+			fmt.Errorf("marshal result: %w", err)))
+	}
+
+	return jsonrpc2.NewJsonRpcSuccess(msg.ID, data)
+}
@@ -0,0 +1,49 @@
+package xapi
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/c0mm4nd/go-jsonrpc2"
+)
+
+func TestHandlerPanicAnswersInternalError(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	reported := make(chan *LoopError, 1)
+	c.ErrorHandler = func(err *LoopError) error {
+		reported <- err
+
+		return nil
+	}
+
+	c.HandleMethod("Test/Panic", func(json.RawMessage) (interface{}, error) {
+		panic("boom")
+	})
+
+	go func() { _ = c.Run() }()
+
+	f.read <- jsonrpc2.NewJsonRpcRequest(float64(7), "Test/Panic", []byte(`{}`))
+
+	select {
+	case resp := <-f.written:
+		if resp.Error == nil || resp.Error.Code != codeInternalError {
+			t.Fatalf("response %+v, want an internal error", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request not answered")
+	}
+
+	select {
+	case err := <-reported:
+		var perr *PanicError
+		if err.Op != OpHandler || !errors.As(err, &perr) || perr.Value != "boom" {
+			t.Fatalf("reported %v, want the handler panic", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic not reported")
+	}
+}
@@ -0,0 +1,202 @@
+package xapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/c0mm4nd/go-jsonrpc2"
+)
+
+const (
+	redacted       = "[REDACTED]"
+	textInputField = "TextInput"
+	responseField  = "Response"
+)
+
+// Logger is a leveled key/value logger.  Every log call has a message followed by
+// alternating keys and values, the same as log/slog, so a *slog.Logger can be used
+// as a Logger as is.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// NewStdLogger adapts a standard library *log.Logger to Logger.  Key/value pairs
+// are written as key=value after the message.  Debug messages, which include the
+// raw JSON-RPC frames, are only written when debug is set.
+func NewStdLogger(l *log.Logger, debug bool) Logger {
+	return &stdLogger{l: l, debug: debug}
+}
+
+type stdLogger struct {
+	l     *log.Logger
+	debug bool
+}
+
+func (s *stdLogger) Debug(msg string, keyvals ...interface{}) {
+	if s.debug {
+		s.print("DEBUG", msg, keyvals)
+	}
+}
+
+func (s *stdLogger) Info(msg string, keyvals ...interface{}) {
+	s.print("INFO", msg, keyvals)
+}
+
+func (s *stdLogger) Warn(msg string, keyvals ...interface{}) {
+	s.print("WARN", msg, keyvals)
+}
+
+func (s *stdLogger) Error(msg string, keyvals ...interface{}) {
+	s.print("ERROR", msg, keyvals)
+}
+
+func (s *stdLogger) print(level string, msg string, keyvals []interface{}) {
+	var b strings.Builder
+
+	b.WriteString(level)
+	b.WriteString(" ")
+	b.WriteString(msg)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 < len(keyvals) {
+			fmt.Fprintf(&b, " %v=%v", keyvals[i], keyvals[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v=MISSING", keyvals[i])
+		}
+	}
+
+	s.l.Print(b.String())
+}
+
+func (c *Client) log() Logger {
+	if c.Logger == nil {
+		return nopLogger{}
+	}
+
+	return c.Logger
+}
+
+// traceClient logs every JSON-RPC frame at debug level.
+type traceClient struct {
+	rpcClient
+	log Logger
+}
+
+func (t *traceClient) WriteMessage(messageType int, msg *jsonrpc2.JsonRpcMessage) error {
+	t.log.Debug("send frame", "frame", redactFrame(msg))
+
+	return t.rpcClient.WriteMessage(messageType, msg)
+}
+
+func (t *traceClient) ReadMessage() (int, *jsonrpc2.JsonRpcMessage, error) {
+	mt, msg, err := t.rpcClient.ReadMessage()
+	if err == nil {
+		t.log.Debug("receive frame", "frame", redactFrame(msg))
+	}
+
+	return mt, msg, err
+}
+
+// redactFrame renders msg as JSON with the value of any field that looks like a
+// secret replaced.
+func redactFrame(msg *jsonrpc2.JsonRpcMessage) string {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Sprintf("unprintable frame: %v", err)
+	}
+
+	var frame interface{}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return string(data)
+	}
+
+	data, err = json.Marshal(redactValue(frame))
+	if err != nil {
+		return fmt.Sprintf("unprintable frame: %v", err)
+	}
+
+	return string(data)
+}
+
+// redactPayload is redactFrame for the raw params or result of a message.
+func redactPayload(payload string) string {
+	if payload == "" {
+		return payload
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(payload), &v); err != nil {
+		return redacted
+	}
+
+	data, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return redacted
+	}
+
+	return string(data)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, val := range x {
+			if isSecretKey(k) {
+				x[k] = redacted
+			} else {
+				x[k] = redactValue(val)
+			}
+		}
+
+		redactTextInput(x)
+	case []interface{}:
+		for i, val := range x {
+			x[i] = redactValue(val)
+		}
+	}
+
+	return v
+}
+
+// redactTextInput hides the text of TextInput responses.  The response doesn't say
+// which input type it came from, so the answers to Password and PIN inputs can only be
+// kept out of the logs by hiding them all.
+func redactTextInput(m map[string]interface{}) {
+	input, ok := m[textInputField].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if resp, ok := input[responseField].(map[string]interface{}); ok {
+		if _, ok := resp[textField]; ok {
+			resp[textField] = redacted
+		}
+	}
+}
+
+func isSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	if k == "pin" {
+		return true
+	}
+
+	for _, v := range []string{"password", "passphrase", "secret", "token", strings.ToLower(credHeader)} {
+		if strings.Contains(k, v) {
+			return true
+		}
+	}
+
+	return false
+}
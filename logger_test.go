@@ -0,0 +1,60 @@
+package xapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/c0mm4nd/go-jsonrpc2"
+)
+
+func TestRedactFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		secret string
+	}{
+		{
+			name:   "password key",
+			params: `{"Password":"hunter2"}`,
+			secret: "hunter2",
+		},
+		{
+			name:   "nested pin",
+			params: `{"Call":{"Pin":"1234"}}`,
+			secret: "1234",
+		},
+		{
+			name:   "text input response",
+			params: `{"Event":{"UserInterface":{"Message":{"TextInput":{"Response":{"FeedbackId":"go-text-input-1","Text":"s3cret"}}}}}}`,
+			secret: "s3cret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := json.RawMessage(tt.params)
+			msg := jsonrpc2.NewJsonRpcNotification("xFeedback/Event", params)
+
+			frame := redactFrame(msg)
+			if strings.Contains(frame, tt.secret) {
+				t.Errorf("frame %s leaks %q", frame, tt.secret)
+			}
+
+			if !strings.Contains(frame, redacted) {
+				t.Errorf("frame %s was not redacted", frame)
+			}
+
+			if p := redactPayload(tt.params); strings.Contains(p, tt.secret) {
+				t.Errorf("payload %s leaks %q", p, tt.secret)
+			}
+		})
+	}
+}
+
+func TestRedactKeepsFeedbackID(t *testing.T) {
+	p := redactPayload(`{"TextInput":{"Response":{"FeedbackId":"go-text-input-1","Text":"x"}}}`)
+	if !strings.Contains(p, "go-text-input-1") {
+		t.Errorf("payload %s lost the FeedbackId", p)
+	}
+}
@@ -0,0 +1,76 @@
+package xapi
+
+import (
+	"fmt"
+
+	"github.com/c0mm4nd/go-jsonrpc2"
+)
+
+// Run loop operations reported in LoopError.Op.
+const (
+	// OpDecode is decoding a message or result from the device.
+	OpDecode = "decode"
+	// OpResponse is routing a response to the request waiting for it.
+	OpResponse = "response"
+	// OpEvent is routing an event to its subscribers.
+	OpEvent = "event"
+	// OpCallback is running a subscription callback, Payload is the subscribed path.
+	OpCallback = "callback"
+	// OpHandler is running a MethodHandler for a request from the device.
+	OpHandler = "handler"
+)
+
+// LoopError is a recoverable error from the run loop with what it was doing when
+// it happened.
+type LoopError struct {
+	Op string
+	// ID is the JSON-RPC id of the message, if it had one.
+	ID interface{}
+	// Method of the message, if it had one.
+	Method string
+	// Payload is the raw params or result of the message.  It is not redacted and may
+	// hold secrets such as TextInput answers, take care when logging it.
+	Payload string
+	Err     error
+}
+
+func newLoopError(op string, msg *jsonrpc2.JsonRpcMessage, err error) *LoopError {
+	e := &LoopError{
+		Op:     op,
+		ID:     msg.ID,
+		Method: msg.Method,
+		Err:    err,
+	}
+
+	switch {
+	case msg.Params != nil:
+		e.Payload = string(*msg.Params)
+	case msg.Result != nil:
+		e.Payload = string(*msg.Result)
+	}
+
+	return e
+}
+
+func (e *LoopError) Error() string {
+	return fmt.Sprintf("run loop %s: %v", e.Op, e.Err)
+}
+
+func (e *LoopError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler receives the recoverable errors of the run loop.  Returning nil keeps
+// the run loop going, returning an error ends Run with it.
+type ErrorHandler func(*LoopError) error
+
+func (c *Client) loopError(err *LoopError) error {
+	if c.ErrorHandler != nil {
+		return c.ErrorHandler(err)
+	}
+
+	c.log().Warn("run loop error", "op", err.Op, "id", err.ID, "method", err.Method,
+		"payload", redactPayload(err.Payload), "error", err.Err)
+
+	return nil
+}
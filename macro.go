@@ -0,0 +1,213 @@
+package xapi
+
+import (
+	"fmt"
+)
+
+const (
+	macroGetCommand        Command = "xCommand/Macros/Macro/Get"
+	macroSaveCommand       Command = "xCommand/Macros/Macro/Save"
+	macroActivateCommand   Command = "xCommand/Macros/Macro/Activate"
+	macroDeactivateCommand Command = "xCommand/Macros/Macro/Deactivate"
+	macroRemoveCommand     Command = "xCommand/Macros/Macro/Remove"
+	macroRestartCommand    Command = "xCommand/Macros/Runtime/Restart"
+	macroNameField                 = "Name"
+	macroField                     = "Macro"
+	xapiTrue                       = "True"
+	xapiFalse                      = "False"
+)
+
+// Macro is a JavaScript macro stored on the device.  Content is only filled in
+// by Macros.Get.
+type Macro struct {
+	Name    string
+	Active  bool
+	Content string
+}
+
+// MacroLog is a single line of log output from a macro.
+type MacroLog struct {
+	Macro   string
+	Level   string
+	Message string
+}
+
+// MacroRuntime controls the macro runtime that all macros run in.
+type MacroRuntime struct {
+	c *Client
+}
+
+// Macros manages the JavaScript macros on the device.
+type Macros struct {
+	Runtime MacroRuntime
+	c       *Client
+}
+
+// Macros returns the macro management API of the device.
+func (c *Client) Macros() *Macros {
+	return &Macros{
+		Runtime: MacroRuntime{c: c},
+		c:       c,
+	}
+}
+
+// List returns all the macros on the device without their content.
+func (m *Macros) List() ([]Macro, error) {
+	res, err := m.c.sendCommand(macroGetCommand, map[string]interface{}{
+		"Content": xapiFalse,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list macros: %w", err)
+	}
+
+	macros, err := parseMacros(res)
+	if err != nil {
+		return nil, fmt.Errorf("list macros: %w", err)
+	}
+
+	return macros, nil
+}
+
+// Get returns a single macro including its source.
+func (m *Macros) Get(name string) (*Macro, error) {
+	res, err := m.c.sendCommand(macroGetCommand, map[string]interface{}{
+		macroNameField: name,
+		"Content":      xapiTrue,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get macro %s: %w", name, err)
+	}
+
+	macros, err := parseMacros(res)
+	if err != nil {
+		return nil, fmt.Errorf("get macro %s: %w", name, err)
+	}
+
+	for _, v := range macros {
+		if v.Name == name {
+			v := v
+
+			return &v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("get macro %s: %w", name, ErrMacroNotFound)
+}
+
+// Save uploads source as the macro name.  Unless overwrite is set saving fails
+// when a macro with that name already exists.  A saved macro needs to be
+// activated and the runtime restarted before it runs.
+func (m *Macros) Save(name string, source string, overwrite bool) error {
+	params := map[string]interface{}{
+		macroNameField: name,
+		"Overwrite":    xapiFalse,
+		"body":         source,
+	}
+
+	if overwrite {
+		params["Overwrite"] = xapiTrue
+	}
+
+	if _, err := m.c.sendCommand(macroSaveCommand, params); err != nil {
+		return fmt.Errorf("save macro %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Activate marks a macro to be run by the runtime.
+func (m *Macros) Activate(name string) error {
+	return m.byName(macroActivateCommand, name)
+}
+
+// Deactivate stops a macro from being run by the runtime.
+func (m *Macros) Deactivate(name string) error {
+	return m.byName(macroDeactivateCommand, name)
+}
+
+// Remove deletes a macro from the device.
+func (m *Macros) Remove(name string) error {
+	return m.byName(macroRemoveCommand, name)
+}
+
+// SubscribeLog calls cb for every line logged by any macro on the device.
+func (m *Macros) SubscribeLog(cb func(MacroLog)) (func() error, error) {
+	return m.c.Subscribe(EventMacrosLog, func(data []interface{}) {
+		for _, v := range data {
+			e, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			cb(MacroLog{
+				Macro:   stringField(e, macroField),
+				Level:   stringField(e, "Level"),
+				Message: stringField(e, "Message"),
+			})
+		}
+	})
+}
+
+func (m *Macros) byName(command Command, name string) error {
+	if _, err := m.c.sendCommand(command, map[string]interface{}{
+		macroNameField: name,
+	}); err != nil {
+		return fmt.Errorf("macro %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Restart restarts the macro runtime so changes to macros take effect.
+func (r MacroRuntime) Restart() error {
+	if _, err := r.c.sendCommand(macroRestartCommand, nil); err != nil {
+		return fmt.Errorf("restart macro runtime: %w", err)
+	}
+
+	return nil
+}
+
+// parseMacros reads the macro list of a Macro Get response.  The device leaves the
+// list out when there are no macros.
+func parseMacros(res interface{}) ([]Macro, error) {
+	m, ok := res.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("macro list %T: %w", res, ErrUnknownResponse)
+	}
+
+	raw, ok := m[macroField]
+	if !ok {
+		return []Macro{}, nil
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("macro list %T: %w", raw, ErrUnknownResponse)
+	}
+
+	macros := make([]Macro, 0, len(list))
+
+	for _, v := range list {
+		e, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("macro %T: %w", v, ErrUnknownResponse)
+		}
+
+		macros = append(macros, Macro{
+			Name:    stringField(e, macroNameField),
+			Active:  stringField(e, "Active") == xapiTrue,
+			Content: stringField(e, "Content"),
+		})
+	}
+
+	return macros, nil
+}
+
+func stringField(m map[string]interface{}, field string) string {
+	v, ok := m[field]
+	if !ok || v == nil {
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
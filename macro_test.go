@@ -0,0 +1,42 @@
+package xapi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseMacros(t *testing.T) {
+	tests := []struct {
+		name string
+		res  interface{}
+		want []Macro
+		err  error
+	}{
+		{
+			name: "list",
+			res: map[string]interface{}{macroField: []interface{}{
+				map[string]interface{}{"Name": "a", "Active": "True", "Content": "x"},
+				map[string]interface{}{"Name": "b", "Active": "False"},
+			}},
+			want: []Macro{{Name: "a", Active: true, Content: "x"}, {Name: "b"}},
+		},
+		{name: "no macros", res: map[string]interface{}{}, want: []Macro{}},
+		{name: "not an object", res: "nope", err: ErrUnknownResponse},
+		{name: "list not an array", res: map[string]interface{}{macroField: "nope"}, err: ErrUnknownResponse},
+		{name: "entry not an object", res: map[string]interface{}{macroField: []interface{}{"nope"}}, err: ErrUnknownResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMacros(tt.res)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package xapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// messageKind ties a non modal message type to the command that clears it and
+// the event the device sends when it goes away.
+type messageKind struct {
+	clear   Command
+	cleared Path
+}
+
+var (
+	alertMessage    = messageKind{clear: alertClearCommand, cleared: EventUserInterfaceMessageAlertCleared}
+	textLineMessage = messageKind{clear: textLineClearCommand, cleared: EventUserInterfaceMessageTextLineCleared}
+)
+
+// Message is a handle to an Alert or TextLine shown on the device.  The device only
+// shows one message of each type, so a message is done once it is dismissed by the
+// user, times out, is cleared or is replaced by a newer message of the same type.
+type Message struct {
+	c      *Client
+	kind   messageKind
+	once   sync.Once
+	done   chan struct{}
+	cancel func() error
+}
+
+func (c *Client) showMessage(ctx context.Context, kind messageKind, command Command,
+	args map[string]interface{}, duration time.Duration) (*Message, error) {
+	m := &Message{
+		c:    c,
+		kind: kind,
+		done: make(chan struct{}),
+	}
+
+	// the cleared event of a replaced message arrives before the response to the
+	// new command, so checking on the run loop keeps it from finishing m.  The
+	// unsubscribe in finish can't run on the run loop and is done separately.
+	cancel, err := c.SubscribeContext(ctx, kind.cleared, func([]interface{}) {
+		if m.current() {
+			go m.finish()
+		}
+	}, withInlineDelivery())
+	if err != nil {
+		return nil, err
+	}
+
+	m.cancel = cancel
+
+	c.cblock.Lock()
+	prev := c.messages[kind.clear]
+	delete(c.messages, kind.clear)
+	c.cblock.Unlock()
+
+	if prev != nil {
+		prev.finish()
+	}
+
+	if _, err := c.sendCommandContext(ctx, command, args); err != nil {
+		m.finish()
+
+		return nil, err
+	}
+
+	// m only becomes current once the device answered, after the previous message
+	// was cleared.  A message shown meanwhile was replaced by m.
+	c.cblock.Lock()
+	prev = c.messages[kind.clear]
+	c.messages[kind.clear] = m
+	c.cblock.Unlock()
+
+	if prev != nil {
+		prev.finish()
+	}
+
+	if duration > 0 {
+		go func() {
+			select {
+			case <-time.After(duration + clearedTimeoutSlack):
+				m.finish()
+			case <-m.done:
+			}
+		}()
+	}
+
+	return m, nil
+}
+
+// Clear removes the message from the device if it is still shown.  Clearing a
+// message that is already done is a no-op, so a newer message is never removed.
+func (m *Message) Clear() error {
+	if !m.current() {
+		return nil
+	}
+
+	if _, err := m.c.sendCommand(m.kind.clear, nil); err != nil {
+		return err
+	}
+
+	return m.finish()
+}
+
+// Cleared returns a channel that is closed once the message is no longer shown.
+func (m *Message) Cleared() <-chan struct{} {
+	return m.done
+}
+
+func (m *Message) current() bool {
+	m.c.cblock.Lock()
+	defer m.c.cblock.Unlock()
+
+	return m.c.messages[m.kind.clear] == m
+}
+
+func (m *Message) finish() error {
+	var err error
+
+	m.once.Do(func() {
+		close(m.done)
+
+		m.c.cblock.Lock()
+		if m.c.messages[m.kind.clear] == m {
+			delete(m.c.messages, m.kind.clear)
+		}
+		m.c.cblock.Unlock()
+
+		err = m.cancel()
+	})
+
+	return err
+}
@@ -0,0 +1,58 @@
+package xapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestReplacedMessageClearedKeepsNewMessage(t *testing.T) {
+	c, f := newTestClient()
+
+	// the device clears the shown alert before it answers the next Display.
+	shown := false
+
+	f.serve(func(method string, _ json.RawMessage) interface{} {
+		if method == string(alertCommand) {
+			if shown {
+				f.event(`{"Event":{"UserInterface":{"Message":{"Alert":{"Cleared":{}}}}}}`)
+			}
+
+			shown = true
+		}
+
+		return map[string]interface{}{}
+	})
+
+	go func() { _ = c.Run() }()
+	defer c.Close()
+
+	first, err := c.Alert("first", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := c.Alert("second", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-first.Cleared():
+	case <-time.After(time.Second):
+		t.Fatal("replaced alert not finished")
+	}
+
+	// leave time for a misdelivered cleared event to finish the new alert.
+	time.Sleep(20 * time.Millisecond)
+
+	select {
+	case <-second.Cleared():
+		t.Fatal("cleared event of the replaced alert finished the new alert")
+	default:
+	}
+
+	if !second.current() {
+		t.Fatal("new alert is not the current alert")
+	}
+}
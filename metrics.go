@@ -0,0 +1,54 @@
+package xapi
+
+import (
+	"time"
+)
+
+// Metrics receives measurements about the health of a Client, such as an adapter to
+// Prometheus.  Calls are made inline from the client so implementations must be safe
+// for concurrent use and should not block.
+type Metrics interface {
+	// RequestStarted is called when a command is sent to the device.
+	RequestStarted(command Command)
+	// RequestFinished is called when a command completes with its latency and error.
+	RequestFinished(command Command, latency time.Duration, err error)
+	// SubscriptionsChanged is called with the number of subscribed paths whenever
+	// it changes.
+	SubscriptionsChanged(count int)
+	// EventReceived is called for every subscribed path an event is delivered to.
+	EventReceived(path Path)
+	// EventDropped is called when an event can not be delivered to a subscriber.
+	EventDropped(reason error)
+	// Connected is called after every successful connect.  reconnect is set for all
+	// but the first connect of the client.
+	Connected(reconnect bool)
+	// Disconnected is called when the connection to the device is lost.
+	Disconnected()
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) RequestStarted(Command)                        {}
+func (nopMetrics) RequestFinished(Command, time.Duration, error) {}
+func (nopMetrics) SubscriptionsChanged(int)                      {}
+func (nopMetrics) EventReceived(Path)                            {}
+func (nopMetrics) EventDropped(error)                            {}
+func (nopMetrics) Connected(bool)                                {}
+func (nopMetrics) Disconnected()                                 {}
+
+func (c *Client) metrics() Metrics {
+	if c.Metrics == nil {
+		return nopMetrics{}
+	}
+
+	return c.Metrics
+}
+
+// subscriptionsChanged reports the current number of subscribed paths.
+func (c *Client) subscriptionsChanged() {
+	c.cblock.Lock()
+	n := len(c.callbacks)
+	c.cblock.Unlock()
+
+	c.metrics().SubscriptionsChanged(n)
+}
@@ -2,28 +2,401 @@ package xapi
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/ohler55/ojg/jp"
 )
 
 // Path represents the xapi path in the system.  It is a space delimited field that can be converted
 // to jpath, parameters for a Get or the path to listen to for events.  If the needed Path for your
 // use case is not implemented here its possible to just define a new path and use all the library
 // functionality with that new path.
+//
+// Multi-instance nodes can be indexed as Name[2] or matched on every instance as Name[*], for
+// example "Status Video Input Connector[2] Connected".  NewPath builds a Path from PathElements.
 type Path string
 
+const (
+	pathWildcard = "*"
+	idField      = "id"
+)
+
+var (
+	pathNameRe   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	pathElemRe   = regexp.MustCompile(`^([^\[\]]+)(?:\[([^\[\]]*)\])?$`)
+	jpIDFilterRe = regexp.MustCompile(`^\[\?\(@\.id == (\d+)`)
+	cliPrefixRe  = regexp.MustCompile(`^x[A-Z]`)
+)
+
+// PathElement is a single node of a Path.
+type PathElement struct {
+	Name string
+	// Index selects a single instance of a multi-instance node when Indexed is set.
+	Index   int
+	Indexed bool
+	// Wildcard selects every instance of a multi-instance node.
+	Wildcard bool
+}
+
+// Node is a PathElement without an index.
+func Node(name string) PathElement {
+	return PathElement{Name: name}
+}
+
+// IndexedNode is a PathElement selecting instance index of a multi-instance node.
+func IndexedNode(name string, index int) PathElement {
+	return PathElement{Name: name, Index: index, Indexed: true}
+}
+
+// WildcardNode is a PathElement selecting every instance of a multi-instance node.
+func WildcardNode(name string) PathElement {
+	return PathElement{Name: name, Wildcard: true}
+}
+
+func (e PathElement) String() string {
+	switch {
+	case e.Wildcard:
+		return e.Name + "[" + pathWildcard + "]"
+	case e.Indexed:
+		return e.Name + "[" + strconv.Itoa(e.Index) + "]"
+	default:
+		return e.Name
+	}
+}
+
+func (e PathElement) validate() error {
+	if !pathNameRe.MatchString(e.Name) {
+		return fmt.Errorf("node name %q: %w", e.Name, ErrInvalidPath)
+	}
+
+	if e.Indexed && e.Wildcard {
+		return fmt.Errorf("node %s is both indexed and a wildcard: %w", e.Name, ErrInvalidPath)
+	}
+
+	if e.Indexed && e.Index < 0 {
+		return fmt.Errorf("node %s index %d: %w", e.Name, e.Index, ErrInvalidPath)
+	}
+
+	return nil
+}
+
+// NewPath builds a Path from its elements.
+func NewPath(elems ...PathElement) Path {
+	parts := make([]string, len(elems))
+	for i, v := range elems {
+		parts[i] = v.String()
+	}
+
+	return Path(strings.Join(parts, " "))
+}
+
+// Append returns a new Path with elems added to the end of p.
+func (p Path) Append(elems ...PathElement) Path {
+	if p == "" {
+		return NewPath(elems...)
+	}
+
+	if len(elems) == 0 {
+		return p
+	}
+
+	return Path(string(p) + " " + string(NewPath(elems...)))
+}
+
+// Elements splits the path into its elements.  An error wrapping ErrInvalidPath is
+// returned for malformed paths.
+func (p Path) Elements() ([]PathElement, error) {
+	fields := strings.Fields(string(p))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty path: %w", ErrInvalidPath)
+	}
+
+	elems := make([]PathElement, 0, len(fields))
+
+	for _, f := range fields {
+		m := pathElemRe.FindStringSubmatch(f)
+		if m == nil {
+			return nil, fmt.Errorf("path %q: element %q: %w", p, f, ErrInvalidPath)
+		}
+
+		e := PathElement{Name: m[1]}
+
+		switch {
+		case m[2] == pathWildcard:
+			e.Wildcard = true
+		case m[2] != "":
+			i, err := strconv.Atoi(m[2])
+			if err != nil {
+				return nil, fmt.Errorf("path %q: index %q: %w", p, m[2], ErrInvalidPath)
+			}
+
+			e.Index, e.Indexed = i, true
+		case strings.Contains(f, "["):
+			return nil, fmt.Errorf("path %q: empty index in %q: %w", p, f, ErrInvalidPath)
+		}
+
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("path %q: %w", p, err)
+		}
+
+		elems = append(elems, e)
+	}
+
+	return elems, nil
+}
+
+// Validate checks that the path is well formed.
+func (p Path) Validate() error {
+	_, err := p.Elements()
+
+	return err
+}
+
+// JSONArray converts the path to the array form used for the Path and Query parameters
+// of the xAPI JSON-RPC commands, with indexes as numbers and wildcards as "*" following
+// the node name.
+func (p Path) JSONArray() ([]interface{}, error) {
+	elems, err := p.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]interface{}, 0, len(elems))
+
+	for _, v := range elems {
+		res = append(res, v.Name)
+
+		switch {
+		case v.Wildcard:
+			res = append(res, pathWildcard)
+		case v.Indexed:
+			res = append(res, v.Index)
+		}
+	}
+
+	return res, nil
+}
+
+// PathFromJSONArray is the reverse of Path.JSONArray.
+func PathFromJSONArray(arr []interface{}) (Path, error) {
+	elems := make([]PathElement, 0, len(arr))
+
+	for i, v := range arr {
+		var last *PathElement
+		if len(elems) > 0 {
+			last = &elems[len(elems)-1]
+		}
+
+		switch x := v.(type) {
+		case string:
+			if x != pathWildcard {
+				elems = append(elems, Node(x))
+
+				continue
+			}
+
+			if last == nil || last.Indexed || last.Wildcard {
+				return "", fmt.Errorf("wildcard at %d: %w", i, ErrInvalidPath)
+			}
+
+			last.Wildcard = true
+		default:
+			idx, ok := toInt(x)
+			if !ok || last == nil || last.Indexed || last.Wildcard {
+				return "", fmt.Errorf("element %v at %d: %w", v, i, ErrInvalidPath)
+			}
+
+			last.Index, last.Indexed = int(idx), true
+		}
+	}
+
+	p := NewPath(elems...)
+
+	return p, p.Validate()
+}
+
+// JSONPath converts the path to a jp expression that finds it anywhere in an event or
+// status document.  Indexed nodes match on the id field of the instance.
+func (p Path) JSONPath() (string, error) {
+	elems, err := p.Elements()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	b.WriteString("$.")
+
+	for _, v := range elems {
+		b.WriteString(".")
+		b.WriteString(v.Name)
+
+		switch {
+		case v.Wildcard:
+			b.WriteString("[*]")
+		case v.Indexed:
+			fmt.Fprintf(&b, "[?(@.%s == %d || @.%s == '%d')]", idField, v.Index, idField, v.Index)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// PathFromJSONPath is the reverse of Path.JSONPath.  Only the child, wildcard and id
+// filter selectors that JSONPath produces are supported.
+func PathFromJSONPath(expr string) (Path, error) {
+	x, err := jp.ParseString(expr)
+	if err != nil {
+		return "", fmt.Errorf("jpath %q: %v: %w", expr, err, ErrInvalidPath)
+	}
+
+	var elems []PathElement
+
+	for i, f := range x {
+		var last *PathElement
+		if len(elems) > 0 {
+			last = &elems[len(elems)-1]
+		}
+
+		switch v := f.(type) {
+		case jp.Root, jp.Descent:
+			if i > 1 {
+				return "", fmt.Errorf("jpath %q: descent inside path: %w", expr, ErrInvalidPath)
+			}
+		case jp.Child:
+			elems = append(elems, Node(string(v)))
+		case jp.Wildcard:
+			if last == nil || last.Indexed || last.Wildcard {
+				return "", fmt.Errorf("jpath %q: misplaced wildcard: %w", expr, ErrInvalidPath)
+			}
+
+			last.Wildcard = true
+		case *jp.Filter:
+			m := jpIDFilterRe.FindStringSubmatch(v.String())
+			if m == nil || last == nil || last.Indexed || last.Wildcard {
+				return "", fmt.Errorf("jpath %q: unsupported filter %s: %w", expr, v, ErrInvalidPath)
+			}
+
+			last.Index, _ = strconv.Atoi(m[1])
+			last.Indexed = true
+		default:
+			return "", fmt.Errorf("jpath %q: unsupported selector %v: %w", expr, f, ErrInvalidPath)
+		}
+	}
+
+	p := NewPath(elems...)
+
+	return p, p.Validate()
+}
+
+// ParsePath parses the path forms found in the device documentation and normalises
+// them to a Path.  Space, slash and dot separated paths are accepted, with or without
+// a leading slash, and the x prefix of the CLI root commands such as xStatus is
+// dropped.  Indexes can be given in brackets or as a number following the node name
+// the way the CLI does, so these all parse to "Status Video Input Connector[1] Connected":
+//
+//	xStatus Video Input Connector 1 Connected
+//	/Status/Video/Input/Connector[1]/Connected
+//	Status.Video.Input.Connector[1].Connected
+func ParsePath(s string) (Path, error) {
+	tokens := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '/' || r == '.' || unicode.IsSpace(r)
+	})
+
+	if len(tokens) > 0 && cliPrefixRe.MatchString(tokens[0]) {
+		tokens[0] = tokens[0][1:]
+	}
+
+	var elems []PathElement
+
+	for _, t := range tokens {
+		var last *PathElement
+		if len(elems) > 0 {
+			last = &elems[len(elems)-1]
+		}
+
+		idx, err := strconv.Atoi(t)
+
+		switch {
+		case t == pathWildcard || err == nil:
+			if last == nil || last.Indexed || last.Wildcard {
+				return "", fmt.Errorf("parse path %q: misplaced index %q: %w", s, t, ErrInvalidPath)
+			}
+
+			if t == pathWildcard {
+				last.Wildcard = true
+			} else {
+				last.Index, last.Indexed = idx, true
+			}
+		default:
+			e, err := Path(t).Elements()
+			if err != nil {
+				return "", fmt.Errorf("parse path %q: %w", s, err)
+			}
+
+			elems = append(elems, e...)
+		}
+	}
+
+	p := NewPath(elems...)
+	if err := p.Validate(); err != nil {
+		return "", fmt.Errorf("parse path %q: %w", s, err)
+	}
+
+	return p, nil
+}
+
+// UnmarshalText parses the path with ParsePath, so paths in config files can be written
+// in any of the forms it accepts.
+func (p *Path) UnmarshalText(text []byte) error {
+	parsed, err := ParsePath(string(text))
+	if err != nil {
+		return err
+	}
+
+	*p = parsed
+
+	return nil
+}
+
 func (p Path) toSubQuery() map[string]interface{} {
 	return map[string]interface{}{
-		"Query": strings.Fields(string(p)),
+		"Query": p.jsonArray(),
 	}
 }
 
 func (p Path) toGetParams() map[string]interface{} {
 	return map[string]interface{}{
-		"Path": strings.Fields(string(p)),
+		"Path": p.jsonArray(),
+	}
+}
+
+// jsonArray is JSONArray for paths that have already been validated, falling back to
+// the plain fields for anything else.
+func (p Path) jsonArray() []interface{} {
+	arr, err := p.JSONArray()
+	if err == nil {
+		return arr
+	}
+
+	fields := strings.Fields(string(p))
+	arr = make([]interface{}, len(fields))
+
+	for i, v := range fields {
+		arr[i] = v
 	}
+
+	return arr
 }
 
 func (p Path) toJSONPath() string {
+	if s, err := p.JSONPath(); err == nil {
+		return s
+	}
+
 	result := "$."
 	for _, x := range strings.Fields(string(p)) {
 		result = fmt.Sprintf("%s.%s", result, x)
@@ -47,6 +420,7 @@ const (
 	EventUserInterfaceExtensionsEventClicked  Path = "Event UserInterface Extensions Event Pressed"
 	EventUserInterfaceExtensionsEventChanged  Path = "Event UserInterface Extensions Event Changed"
 	EventUserInterfaceWidgetAction            Path = "Event UserInterface Extensions Widget Action"
+	EventUserInterfaceWidgetLayoutUpdated     Path = "Event UserInterface Extensions Widget LayoutUpdated"
 	EventUserInterfacePanelClicked            Path = "Event UserInterface Extensions Panel Clicked"
 	EventUserInterfacePanelClose              Path = "Event UserInterface Extensions Panel Close"
 	EventUserInterfacePanelOpen               Path = "Event UserInterface Extensions Panel Open"
@@ -54,9 +428,11 @@ const (
 	EventUserInterfaceRatingResponse          Path = "Event UserInterface Message Rating Response"
 	EventUserInterfaceTextInputResponse       Path = "Event UserInterface Message TextInput Response"
 	EventUserInterfaceTextInputResponseClear  Path = "Event UserInterface Message TextInput Clear"
+	EventUserInterfaceMessagePromptCleared    Path = "Event UserInterface Message Prompt Cleared"
 	EventUserInterfaceMessageAlertCleared     Path = "Event UserInterface Message Alert Cleared"
 	EventUserInterfaceMessageRatingCleared    Path = "Event UserInterface Message Rating Cleared"
 	EventUserInterfaceMessageTextLineCleared  Path = "Event UserInterface Message TextLine Cleared"
+	EventMacrosLog                            Path = "Event Macros Log"
 	EventShutdown                             Path = "Event Shutdown"
 	EventIncomingCallIndication               Path = "Event IncomingCallIndication"
 )
@@ -0,0 +1,181 @@
+package xapi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ohler55/ojg/jp"
+)
+
+func TestJSONPathRoundTrip(t *testing.T) {
+	tests := []struct {
+		path Path
+		want string
+	}{
+		{"Status Audio Volume", "$..Status.Audio.Volume"},
+		{"Status Video Input Connector[*] Connected", "$..Status.Video.Input.Connector[*].Connected"},
+		{
+			"Status Video Input Connector[2] Connected",
+			"$..Status.Video.Input.Connector[?(@.id == 2 || @.id == '2')].Connected",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.path), func(t *testing.T) {
+			got, err := tt.path.JSONPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("JSONPath %q, want %q", got, tt.want)
+			}
+
+			back, err := PathFromJSONPath(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if back != tt.path {
+				t.Fatalf("PathFromJSONPath %q, want %q", back, tt.path)
+			}
+		})
+	}
+}
+
+func TestPathFromJSONPathInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"$..Status..Audio",
+		"$..[*]",
+		"$..Status[?(@.Name == 'x')]",
+		"$..Status[*][*]",
+		"$..Status[",
+	} {
+		if _, err := PathFromJSONPath(expr); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("PathFromJSONPath(%q) returned %v, want ErrInvalidPath", expr, err)
+		}
+	}
+}
+
+func TestJSONArrayRoundTrip(t *testing.T) {
+	tests := []struct {
+		path Path
+		want []interface{}
+	}{
+		{"Status Audio Volume", []interface{}{"Status", "Audio", "Volume"}},
+		{"Status Video Input Connector[*]", []interface{}{"Status", "Video", "Input", "Connector", "*"}},
+		{"Status Video Input Connector[2] Connected", []interface{}{"Status", "Video", "Input", "Connector", 2, "Connected"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.path), func(t *testing.T) {
+			got, err := tt.path.JSONArray()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("JSONArray %v, want %v", got, tt.want)
+			}
+
+			back, err := PathFromJSONArray(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if back != tt.path {
+				t.Fatalf("PathFromJSONArray %q, want %q", back, tt.path)
+			}
+		})
+	}
+}
+
+func TestIndexedFilter(t *testing.T) {
+	x := jp.MustParseString(Path("Status Video Input Connector[2] Connected").toJSONPath())
+
+	tests := []struct {
+		name string
+		id   interface{}
+		want []interface{}
+	}{
+		{"number id", int64(2), []interface{}{"True"}},
+		{"decoded number id", float64(2), []interface{}{"True"}},
+		{"string id", "2", []interface{}{"True"}},
+		{"other id", "1", []interface{}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]interface{}{"Status": map[string]interface{}{"Video": map[string]interface{}{
+				"Input": map[string]interface{}{"Connector": []interface{}{
+					map[string]interface{}{"id": tt.id, "Connected": "True"},
+				}},
+			}}}
+
+			got := x.Get(doc)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathElementsInvalid(t *testing.T) {
+	for _, p := range []Path{"", "Status Audio[", "Status Audio[]", "Status Audio[x]", "Status Au!dio"} {
+		if err := p.Validate(); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Validate(%q) returned %v, want ErrInvalidPath", p, err)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Path
+	}{
+		{"Status Audio Volume", "Status Audio Volume"},
+		{"xStatus Audio Volume", "Status Audio Volume"},
+		{"xStatus Video Input Connector 1 Connected", "Status Video Input Connector[1] Connected"},
+		{"/Status/Video/Input/Connector[1]/Connected", "Status Video Input Connector[1] Connected"},
+		{"Status.Video.Input.Connector[1].Connected", "Status Video Input Connector[1] Connected"},
+		{"Status/Video/Input/Connector/*", "Status Video Input Connector[*]"},
+		{"xConfiguration Audio DefaultVolume", "Configuration Audio DefaultVolume"},
+		{"  Status   Audio  ", "Status Audio"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePath(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("ParsePath %q, want %q", got, tt.want)
+			}
+
+			// a parsed path parses to itself.
+			again, err := ParsePath(string(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if again != got {
+				t.Fatalf("ParsePath(%q) %q, not a round trip", got, again)
+			}
+		})
+	}
+}
+
+func TestParsePathInvalid(t *testing.T) {
+	for _, s := range []string{"", "1 Status", "Status Connector 1 2", "Status Connector[1] 2", "* Status", "Status/Au!dio"} {
+		if _, err := ParsePath(s); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("ParsePath(%q) returned %v, want ErrInvalidPath", s, err)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package xapi
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+const ghostField = "ghost"
+
+type statusWatcher struct {
+	path []PathElement
+	fn   func(old, new interface{})
+}
+
+// StatusCache keeps a local copy of a branch of the device status, such as
+// "Status Audio".  It loads the branch with Get, then merges in the partial updates
+// the device sends for it.  The cache resyncs on every connect so it stays correct
+// across reconnects.
+type StatusCache struct {
+	// OnError is called with errors from the automatic resync on connect.
+	OnError  func(error)
+	client   *Client
+	path     Path
+	elems    []PathElement
+	lock     sync.Mutex
+	root     map[string]interface{}
+	watchers map[uint64]*statusWatcher
+	watchSeq uint64
+	// startLock serializes Start, cancel removes the subscription of the last Start.
+	startLock sync.Mutex
+	cancel    func() error
+}
+
+// NewStatusCache creates a cache of path bound to the client.  The path can not contain
+// indexed or wildcard nodes.  It should be created before the client connects, if it
+// is not call Start to load it.
+func NewStatusCache(c *Client, path Path) (*StatusCache, error) {
+	elems, err := path.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range elems {
+		if v.Indexed || v.Wildcard {
+			return nil, fmt.Errorf("status cache %s: indexed nodes are not supported: %w", path, ErrInvalidPath)
+		}
+	}
+
+	s := &StatusCache{
+		client:   c,
+		path:     path,
+		elems:    elems,
+		root:     make(map[string]interface{}),
+		watchers: make(map[uint64]*statusWatcher),
+	}
+
+	c.onConnect(func(*Client) {
+		if err := s.Start(); err != nil && s.OnError != nil {
+			s.OnError(err)
+		}
+	})
+
+	return s, nil
+}
+
+// Start subscribes to the cached path and loads its current value.  This is done
+// automatically on connect.  Calling it again reloads the value, it never subscribes
+// the cache more than once.
+func (s *StatusCache) Start() error {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+
+	// updates apply on top of each other so they have to be merged in order.
+	cancel, err := s.client.Subscribe(s.path, s.handle, WithSerialDelivery())
+	if err != nil {
+		return fmt.Errorf("status cache %s: %w", s.path, err)
+	}
+
+	// the new subscription is in place before the old one goes, so the device
+	// subscription is kept.
+	old := s.cancel
+	s.cancel = cancel
+
+	if old != nil {
+		if err := old(); err != nil {
+			return fmt.Errorf("status cache %s: %w", s.path, err)
+		}
+	}
+
+	v, err := s.client.Get(s.path)
+	if err != nil {
+		return fmt.Errorf("status cache %s: %w", s.path, err)
+	}
+
+	s.update(func() {
+		s.set(s.elems, normalizeValue(v))
+	})
+
+	return nil
+}
+
+// Value returns the cached value of path, which has to be inside the cached branch.
+func (s *StatusCache) Value(path Path) (interface{}, bool) {
+	elems, err := path.Elements()
+	if err != nil {
+		return nil, false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	v, ok := lookupValue(s.root, elems)
+
+	return normalizeValue(v), ok
+}
+
+// Snapshot returns a copy of the whole cached branch.
+func (s *StatusCache) Snapshot() interface{} {
+	v, _ := s.Value(s.path)
+
+	return v
+}
+
+// OnChange calls fn with the old and new value of path whenever an update from the
+// device changes it.  Values are nil when missing.  The returned func removes fn.
+func (s *StatusCache) OnChange(path Path, fn func(old, new interface{})) (func(), error) {
+	elems, err := path.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.watchSeq++
+	id := s.watchSeq
+	s.watchers[id] = &statusWatcher{path: elems, fn: fn}
+
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		delete(s.watchers, id)
+	}, nil
+}
+
+func (s *StatusCache) handle(data []interface{}) {
+	s.update(func() {
+		for _, v := range data {
+			s.merge(s.elems, normalizeValue(v))
+		}
+	})
+}
+
+// update runs change under the lock and then notifies the watchers whose value changed.
+func (s *StatusCache) update(change func()) {
+	type notify struct {
+		fn       func(old, new interface{})
+		old, new interface{}
+	}
+
+	s.lock.Lock()
+
+	olds := make(map[uint64]interface{}, len(s.watchers))
+	for k, w := range s.watchers {
+		v, _ := lookupValue(s.root, w.path)
+		olds[k] = normalizeValue(v)
+	}
+
+	change()
+
+	var notifies []notify
+
+	for k, w := range s.watchers {
+		v, _ := lookupValue(s.root, w.path)
+		if !reflect.DeepEqual(olds[k], v) {
+			notifies = append(notifies, notify{fn: w.fn, old: olds[k], new: normalizeValue(v)})
+		}
+	}
+	s.lock.Unlock()
+
+	for _, n := range notifies {
+		n.fn(n.old, n.new)
+	}
+}
+
+// set replaces the value at elems, creating any missing parents.
+func (s *StatusCache) set(elems []PathElement, v interface{}) {
+	parent := s.parent(elems)
+	parent[elems[len(elems)-1].Name] = v
+}
+
+// merge merges a partial update into the value at elems.
+func (s *StatusCache) merge(elems []PathElement, v interface{}) {
+	parent := s.parent(elems)
+	name := elems[len(elems)-1].Name
+	parent[name] = mergeValue(parent[name], v)
+}
+
+func (s *StatusCache) parent(elems []PathElement) map[string]interface{} {
+	node := s.root
+
+	for _, e := range elems[:len(elems)-1] {
+		next, ok := node[e.Name].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			node[e.Name] = next
+		}
+
+		node = next
+	}
+
+	return node
+}
+
+// mergeValue merges update into existing.  Objects are merged key by key and lists of
+// instances are merged by their id, with ghost instances removed.
+func mergeValue(existing, update interface{}) interface{} {
+	switch u := update.(type) {
+	case map[string]interface{}:
+		e, ok := existing.(map[string]interface{})
+		if !ok {
+			return u
+		}
+
+		for k, v := range u {
+			e[k] = mergeValue(e[k], v)
+		}
+
+		return e
+	case []interface{}:
+		e, ok := existing.([]interface{})
+		if !ok {
+			e = nil
+		}
+
+		for _, v := range u {
+			e = mergeInstance(e, v)
+		}
+
+		return e
+	default:
+		return update
+	}
+}
+
+func mergeInstance(list []interface{}, update interface{}) []interface{} {
+	u, ok := update.(map[string]interface{})
+	if !ok || u[idField] == nil {
+		return append(list, update)
+	}
+
+	id := fmt.Sprint(u[idField])
+	ghost := fmt.Sprint(u[ghostField]) == xapiTrue
+
+	for i, v := range list {
+		m, ok := v.(map[string]interface{})
+		if !ok || fmt.Sprint(m[idField]) != id {
+			continue
+		}
+
+		if ghost {
+			return append(list[:i], list[i+1:]...)
+		}
+
+		list[i] = mergeValue(m, u)
+
+		return list
+	}
+
+	if ghost {
+		return list
+	}
+
+	return append(list, u)
+}
+
+// lookupValue finds elems in a status document.  Indexed nodes pick the instance with
+// a matching id and wildcard nodes return the whole list.
+func lookupValue(node interface{}, elems []PathElement) (interface{}, bool) {
+	for _, e := range elems {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		node, ok = m[e.Name]
+		if !ok {
+			return nil, false
+		}
+
+		if !e.Indexed {
+			continue
+		}
+
+		list, ok := node.([]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		node = nil
+
+		for _, v := range list {
+			if inst, ok := v.(map[string]interface{}); ok && fmt.Sprint(inst[idField]) == fmt.Sprint(e.Index) {
+				node = inst
+
+				break
+			}
+		}
+
+		if node == nil {
+			return nil, false
+		}
+	}
+
+	return node, true
+}
+
+// normalizeValue deep copies v converting the int64 numbers of parsed events to the
+// float64 used by command results, so values from both compare equal.
+func normalizeValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			res[k] = normalizeValue(v)
+		}
+
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(x))
+		for i, v := range x {
+			res[i] = normalizeValue(v)
+		}
+
+		return res
+	case int64:
+		return float64(x)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,251 @@
+package xapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		update   string
+		want     string
+	}{
+		{
+			name:     "scalar replaced",
+			existing: `50`,
+			update:   `60`,
+			want:     `60`,
+		},
+		{
+			name:     "object merged by key",
+			existing: `{"Volume":50,"Microphones":{"Mute":"Off"}}`,
+			update:   `{"Microphones":{"Mute":"On"}}`,
+			want:     `{"Volume":50,"Microphones":{"Mute":"On"}}`,
+		},
+		{
+			name:     "object replaces scalar",
+			existing: `"x"`,
+			update:   `{"A":1}`,
+			want:     `{"A":1}`,
+		},
+		{
+			name:     "instance merged by id",
+			existing: `[{"id":1,"Status":"Idle","Name":"a"},{"id":2,"Status":"Idle"}]`,
+			update:   `[{"id":1,"Status":"Connected"}]`,
+			want:     `[{"id":1,"Status":"Connected","Name":"a"},{"id":2,"Status":"Idle"}]`,
+		},
+		{
+			name:     "string and number ids match",
+			existing: `[{"id":1,"Status":"Idle"}]`,
+			update:   `[{"id":"1","Status":"Connected"}]`,
+			want:     `[{"id":"1","Status":"Connected"}]`,
+		},
+		{
+			name:     "new instance appended",
+			existing: `[{"id":1}]`,
+			update:   `[{"id":2,"Status":"Idle"}]`,
+			want:     `[{"id":1},{"id":2,"Status":"Idle"}]`,
+		},
+		{
+			name:     "ghost removes instance",
+			existing: `[{"id":1},{"id":2},{"id":3}]`,
+			update:   `[{"id":2,"ghost":"True"}]`,
+			want:     `[{"id":1},{"id":3}]`,
+		},
+		{
+			name:     "ghost of unknown instance ignored",
+			existing: `[{"id":1}]`,
+			update:   `[{"id":7,"ghost":"True"}]`,
+			want:     `[{"id":1}]`,
+		},
+		{
+			name:     "list into missing value",
+			existing: `null`,
+			update:   `[{"id":1,"Status":"Idle"}]`,
+			want:     `[{"id":1,"Status":"Idle"}]`,
+		},
+		{
+			name:     "values without id appended",
+			existing: `["a"]`,
+			update:   `["b"]`,
+			want:     `["a","b"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeValue(decode(t, tt.existing), decode(t, tt.update))
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	in := map[string]interface{}{
+		"A": int64(5),
+		"B": []interface{}{int64(1), "x", map[string]interface{}{"C": int64(2)}},
+		"D": 1.5,
+	}
+	want := map[string]interface{}{
+		"A": float64(5),
+		"B": []interface{}{float64(1), "x", map[string]interface{}{"C": float64(2)}},
+		"D": 1.5,
+	}
+
+	got := normalizeValue(in)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got.(map[string]interface{})["A"] = "changed"
+	if in["A"] != int64(5) {
+		t.Error("normalizeValue did not copy its input")
+	}
+}
+
+func TestLookupValue(t *testing.T) {
+	doc := decode(t, `{"Status":{"Video":{"Input":{"Connector":[{"id":1,"Connected":"True"},{"id":2,"Connected":"False"}]}}}}`)
+
+	tests := []struct {
+		path Path
+		want interface{}
+		ok   bool
+	}{
+		{path: "Status Video Input Connector[2] Connected", want: "False", ok: true},
+		{path: "Status Video Input Connector[3] Connected", ok: false},
+		{path: "Status Video Missing", ok: false},
+	}
+
+	for _, tt := range tests {
+		elems, err := tt.path.Elements()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, ok := lookupValue(doc, elems)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("%s: got %v %v, want %v %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestStatusCacheStartTwice(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	var (
+		lock  sync.Mutex
+		calls = map[string]int{}
+	)
+
+	f.serve(func(method string, _ json.RawMessage) interface{} {
+		lock.Lock()
+		calls[method]++
+		lock.Unlock()
+
+		if method == string(getCommand) {
+			return map[string]interface{}{"Volume": 50}
+		}
+
+		return map[string]interface{}{}
+	})
+
+	go func() { _ = c.Run() }()
+
+	s, err := NewStatusCache(c, "Status Audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.cblock.Lock()
+	subs := len(c.callbacks["Status Audio"])
+	c.cblock.Unlock()
+
+	if subs != 1 {
+		t.Errorf("%d subscriptions after starting twice, want 1", subs)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if calls[string(feedbackSusbscribe)] != 1 || calls[string(feedbackUnsubscribe)] != 0 {
+		t.Errorf("device saw %v", calls)
+	}
+}
+
+func TestStatusCacheMergesInOrder(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	f.serve(func(method string, _ json.RawMessage) interface{} {
+		if method == string(getCommand) {
+			return map[string]interface{}{"Volume": 0}
+		}
+
+		return map[string]interface{}{}
+	})
+
+	go func() { _ = c.Run() }()
+
+	s, err := NewStatusCache(c, "Status Audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	const last = 200
+
+	done := make(chan struct{})
+
+	if _, err := s.OnChange("Status Audio Volume", func(_, v interface{}) {
+		if v == float64(last) {
+			close(done)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= last; i++ {
+		f.event(fmt.Sprintf(`{"Status":{"Audio":{"Volume":%d}}}`, i))
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("last update never arrived")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if v, _ := s.Value("Status Audio Volume"); v != float64(last) {
+		t.Errorf("cache holds %v after the last update %d", v, last)
+	}
+}
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
@@ -0,0 +1,87 @@
+package xapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Span attribute keys set by the client.
+const (
+	AttrMethod = "xapi.method"
+	AttrPath   = "xapi.path"
+	AttrSeq    = "xapi.seq"
+	AttrStatus = "xapi.status"
+)
+
+// Tracer is an optional hook to trace commands and callbacks, such as a thin adapter to
+// an OpenTelemetry tracer.  Command spans are children of the context given to the
+// context aware methods like GetContext; callback spans start a new trace.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, Span)
+}
+
+// Span is a single traced operation started by a Tracer.
+type Span interface {
+	SetAttributes(attrs map[string]interface{})
+	// End finishes the span, err is the outcome of the operation and may be nil.
+	End(err error)
+}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string, _ map[string]interface{}) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(map[string]interface{}) {}
+func (nopSpan) End(error)                            {}
+
+func (c *Client) tracer() Tracer {
+	if c.Tracer == nil {
+		return nopTracer{}
+	}
+
+	return c.Tracer
+}
+
+// runCallback calls cb inside a span for path.
+func (c *Client) runCallback(path Path, cb CallbackFunc, data []interface{}) {
+	_, span := c.tracer().Start(context.Background(), "xapi callback "+string(path), map[string]interface{}{
+		AttrPath: string(path),
+	})
+	defer span.End(nil)
+
+	cb(data)
+}
+
+// paramsPath finds the xAPI path a command is about from its Path or Query parameter.
+func paramsPath(params interface{}) string {
+	m, ok := params.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	for _, k := range []string{"Path", "Query"} {
+		if v, ok := m[k].([]interface{}); ok {
+			parts := make([]string, len(v))
+			for i, x := range v {
+				parts[i] = fmt.Sprint(x)
+			}
+
+			return strings.Join(parts, " ")
+		}
+	}
+
+	return ""
+}
+
+func resultStatus(err error) string {
+	if err != nil {
+		return "Error"
+	}
+
+	return "OK"
+}
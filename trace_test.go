@@ -0,0 +1,72 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countTracer counts the spans started per name.
+type countTracer struct {
+	lock  sync.Mutex
+	spans map[string]int
+}
+
+func (t *countTracer) Start(ctx context.Context, name string, _ map[string]interface{}) (context.Context, Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.spans == nil {
+		t.spans = make(map[string]int)
+	}
+	t.spans[name]++
+
+	return ctx, nopSpan{}
+}
+
+func (t *countTracer) count(name string) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.spans[name]
+}
+
+func TestCoalescedCallbackSpan(t *testing.T) {
+	c, f := newTestClient()
+	tr := &countTracer{}
+	c.Tracer = tr
+
+	f.serve(func(string, json.RawMessage) interface{} { return map[string]interface{}{} })
+
+	go func() { _ = c.Run() }()
+	defer c.Close()
+
+	done := make(chan struct{}, 1)
+
+	if _, err := c.Subscribe(EventUserInterfaceWidgetAction, func([]interface{}) {
+		done <- struct{}{}
+	}, WithLatestOnly()); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := c.callbacks[EventUserInterfaceWidgetAction]
+	for id, s := range sub {
+		if err := c.dispatch(id, EventUserInterfaceWidgetAction, s,
+			widgetEvent("slider", WidgetChanged, "1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+
+	name := "xapi callback " + string(EventUserInterfaceWidgetAction)
+	if n := tr.count(name); n != 1 {
+		t.Fatalf("%d callback spans for one event, want 1", n)
+	}
+}
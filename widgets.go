@@ -0,0 +1,350 @@
+package xapi
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	widgetIDField   = "WidgetId"
+	widgetTypeField = "Type"
+	widgetValField  = "Value"
+	sliderMax       = 255
+	toggleOn        = "on"
+	toggleOff       = "off"
+)
+
+// WidgetEventType is the kind of action a user performed on a UI Extension widget.
+type WidgetEventType string
+
+const (
+	// WidgetPressed is sent when a widget is touched.
+	WidgetPressed WidgetEventType = "pressed"
+	// WidgetReleased is sent when a widget is let go of.
+	WidgetReleased WidgetEventType = "released"
+	// WidgetChanged is sent when the value of a widget changes, such as
+	// flipping a toggle or dragging a slider.
+	WidgetChanged WidgetEventType = "changed"
+	// WidgetClicked is sent for a full press and release of a button.
+	WidgetClicked WidgetEventType = "clicked"
+)
+
+// WidgetEvent is a single action on a widget as reported by the Webex device.
+type WidgetEvent struct {
+	WidgetID string
+	Type     WidgetEventType
+	Value    string
+}
+
+type widgetBinding struct {
+	value  func() interface{}
+	action func(WidgetEvent) error
+}
+
+// Widgets binds UI Extension widgets to Go state.  Values are pushed to the device
+// on every connect, whenever a panel is opened and when the extensions are reloaded,
+// and user actions on the device are routed to the handlers of the bound widget.
+type Widgets struct {
+	// OnError is called with errors that happen while handling events from the
+	// device, as there is no caller to return them to.
+	OnError func(error)
+	client  *Client
+	opts    []SubscribeOption
+	lock    sync.Mutex
+	widgets map[string]*widgetBinding
+	// startLock serializes Start and Stop, cancels removes the subscriptions of the
+	// last Start.
+	startLock sync.Mutex
+	cancels   []func() error
+}
+
+// NewWidgets creates a Widgets bound to the client.  It should be created before
+// the client connects so the widgets are synced on the first connect as well as
+// any following reconnects.  opts apply to the widget action events of every bound
+// widget, such as WithThrottle to limit the rate of slider updates.  Coalescing can
+// merge the clicks of a button, so bind buttons to a separate Widgets.
+func NewWidgets(c *Client, opts ...SubscribeOption) *Widgets {
+	w := &Widgets{
+		client:  c,
+		opts:    opts,
+		widgets: make(map[string]*widgetBinding),
+	}
+
+	c.onConnect(func(*Client) {
+		if err := w.Start(); err != nil {
+			w.reportErr(err)
+		}
+	})
+
+	return w
+}
+
+// Start subscribes to the widget and panel events and pushes the current value of
+// every bound widget to the device.  This is done automatically on connect.  Calling
+// it again only resyncs the widgets, the events are never subscribed more than once.
+func (w *Widgets) Start() error {
+	w.startLock.Lock()
+	defer w.startLock.Unlock()
+
+	resync := func([]interface{}) {
+		if err := w.Sync(); err != nil {
+			w.reportErr(err)
+		}
+	}
+
+	subs := []struct {
+		path Path
+		cb   CallbackFunc
+		opts []SubscribeOption
+	}{
+		{EventUserInterfaceWidgetAction, w.handleAction, w.opts},
+		// widget actions also raise Extensions Event, resyncing on those would push
+		// stale values back while a slider is dragged.  Only a panel that opens or
+		// extensions that are (re)loaded need the values again.
+		{EventUserInterfacePanelOpen, resync, nil},
+		{EventUserInterfaceWidgetLayoutUpdated, resync, nil},
+	}
+
+	cancels := make([]func() error, 0, len(subs))
+
+	for _, v := range subs {
+		cancel, err := w.client.Subscribe(v.path, v.cb, v.opts...)
+		if err != nil {
+			_ = cancelAll(cancels)
+
+			return err
+		}
+
+		cancels = append(cancels, cancel)
+	}
+
+	// the new subscriptions are in place before the old ones go, so the device
+	// subscriptions are kept.
+	old := w.cancels
+	w.cancels = cancels
+
+	if err := cancelAll(old); err != nil {
+		return err
+	}
+
+	return w.Sync()
+}
+
+// Stop removes the event subscriptions of Start.  Widgets are no longer routed or
+// resynced until the next Start, which happens on the next connect.
+func (w *Widgets) Stop() error {
+	w.startLock.Lock()
+	defer w.startLock.Unlock()
+
+	cancels := w.cancels
+	w.cancels = nil
+
+	return cancelAll(cancels)
+}
+
+func cancelAll(cancels []func() error) error {
+	var res error
+
+	for _, v := range cancels {
+		if err := v(); err != nil {
+			res = multierror.Append(res, err)
+		}
+	}
+
+	return res
+}
+
+// BindToggle binds a toggle widget to a bool.  get is used to read the value pushed to
+// the device and set is called when the user flips the toggle.
+func (w *Widgets) BindToggle(widgetID string, get func() bool, set func(bool)) {
+	w.bind(widgetID, &widgetBinding{
+		value: func() interface{} {
+			if get() {
+				return toggleOn
+			}
+
+			return toggleOff
+		},
+		action: func(ev WidgetEvent) error {
+			if ev.Type == WidgetChanged {
+				set(ev.Value == toggleOn)
+			}
+
+			return nil
+		},
+	})
+}
+
+// BindSlider binds a slider widget to a float64 in the range of min to max.  The device
+// uses a fixed 0-255 range for sliders which is scaled to and from the given range.
+// ErrInvalidRange is returned when max is not above min.
+func (w *Widgets) BindSlider(widgetID string, min, max float64, get func() float64, set func(float64)) error {
+	if !(max > min) {
+		return fmt.Errorf("slider %s range %v-%v: %w", widgetID, min, max, ErrInvalidRange)
+	}
+
+	w.bind(widgetID, &widgetBinding{
+		value: func() interface{} {
+			v := (get() - min) / (max - min) * sliderMax
+
+			return int64(math.Round(math.Max(0, math.Min(sliderMax, v))))
+		},
+		action: func(ev WidgetEvent) error {
+			if ev.Type != WidgetChanged {
+				return nil
+			}
+
+			v, err := strconv.ParseFloat(ev.Value, 64)
+			if err != nil {
+				return fmt.Errorf("slider %s: %w", ev.WidgetID, err)
+			}
+
+			set(min + v/sliderMax*(max-min))
+
+			return nil
+		},
+	})
+
+	return nil
+}
+
+// BindGroupButton binds a group button widget to the ID of the selected button.
+func (w *Widgets) BindGroupButton(widgetID string, get func() string, set func(string)) {
+	w.bind(widgetID, &widgetBinding{
+		value: func() interface{} {
+			return get()
+		},
+		action: func(ev WidgetEvent) error {
+			if ev.Type == WidgetPressed {
+				set(ev.Value)
+			}
+
+			return nil
+		},
+	})
+}
+
+// BindButton routes the actions of a stateless button to handler.  Nothing is pushed
+// to the device for a button.
+func (w *Widgets) BindButton(widgetID string, handler func(WidgetEventType)) {
+	w.bind(widgetID, &widgetBinding{
+		action: func(ev WidgetEvent) error {
+			handler(ev.Type)
+
+			return nil
+		},
+	})
+}
+
+// Unbind stops syncing the widget.
+func (w *Widgets) Unbind(widgetID string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.widgets, widgetID)
+}
+
+// Update pushes the current value of a single widget to the device.  Call this when
+// the bound Go state changes from somewhere other than the device.
+func (w *Widgets) Update(widgetID string) error {
+	w.lock.Lock()
+	b, ok := w.widgets[widgetID]
+	w.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("widget %s: %w", widgetID, ErrUnknownWidget)
+	}
+
+	return w.push(widgetID, b)
+}
+
+// Sync pushes the current value of every bound widget to the device.
+func (w *Widgets) Sync() error {
+	w.lock.Lock()
+	bindings := make(map[string]*widgetBinding, len(w.widgets))
+	for k, v := range w.widgets {
+		bindings[k] = v
+	}
+	w.lock.Unlock()
+
+	var res error
+
+	for k, v := range bindings {
+		if err := w.push(k, v); err != nil {
+			res = multierror.Append(res, err)
+		}
+	}
+
+	return res
+}
+
+func (w *Widgets) bind(widgetID string, b *widgetBinding) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.widgets[widgetID] = b
+}
+
+func (w *Widgets) push(widgetID string, b *widgetBinding) error {
+	if b.value == nil {
+		return nil
+	}
+
+	if err := w.client.SetWidgetValue(widgetID, b.value()); err != nil {
+		return fmt.Errorf("widget %s: %w", widgetID, err)
+	}
+
+	return nil
+}
+
+func (w *Widgets) handleAction(data []interface{}) {
+	for _, v := range data {
+		ev, ok := parseWidgetEvent(v)
+		if !ok {
+			continue
+		}
+
+		w.lock.Lock()
+		b, ok := w.widgets[ev.WidgetID]
+		w.lock.Unlock()
+
+		if !ok || b.action == nil {
+			continue
+		}
+
+		if err := b.action(ev); err != nil {
+			w.reportErr(err)
+		}
+	}
+}
+
+func (w *Widgets) reportErr(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+func parseWidgetEvent(data interface{}) (WidgetEvent, bool) {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return WidgetEvent{}, false
+	}
+
+	id, ok := m[widgetIDField].(string)
+	if !ok {
+		return WidgetEvent{}, false
+	}
+
+	ev := WidgetEvent{
+		WidgetID: id,
+		Type:     WidgetEventType(fmt.Sprint(m[widgetTypeField])),
+	}
+
+	if v, ok := m[widgetValField]; ok {
+		ev.Value = fmt.Sprint(v)
+	}
+
+	return ev, true
+}
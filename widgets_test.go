@@ -0,0 +1,157 @@
+package xapi
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBindSliderRejectsEmptyRange(t *testing.T) {
+	c, _ := newTestClient()
+	w := NewWidgets(c)
+
+	for _, r := range [][2]float64{{1, 1}, {10, 0}} {
+		err := w.BindSlider("slider", r[0], r[1], func() float64 { return 0 }, func(float64) {})
+		if !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("range %v returned %v, want ErrInvalidRange", r, err)
+		}
+	}
+
+	if err := w.Update("slider"); !errors.Is(err, ErrUnknownWidget) {
+		t.Errorf("rejected slider was bound: %v", err)
+	}
+}
+
+func TestWidgetsStartTwiceAndStop(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	var (
+		lock  sync.Mutex
+		calls = make(map[string]int)
+	)
+
+	f.serve(func(method string, _ json.RawMessage) interface{} {
+		lock.Lock()
+		calls[method]++
+		lock.Unlock()
+
+		return map[string]interface{}{}
+	})
+
+	go func() { _ = c.Run() }()
+
+	w := NewWidgets(c)
+
+	for i := 0; i < 2; i++ {
+		if err := w.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subscribed := func() int {
+		c.cblock.Lock()
+		defer c.cblock.Unlock()
+
+		n := 0
+		for _, v := range c.callbacks {
+			n += len(v)
+		}
+
+		return n
+	}
+
+	if n := subscribed(); n != 3 {
+		t.Errorf("%d subscriptions after starting twice, want 3", n)
+	}
+
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := subscribed(); n != 0 {
+		t.Errorf("%d subscriptions after stop, want 0", n)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if calls[string(feedbackSusbscribe)] != 3 || calls[string(feedbackUnsubscribe)] != 3 {
+		t.Errorf("device saw %v", calls)
+	}
+}
+
+func TestWidgetsSubscribeOptions(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	f.serve(func(string, json.RawMessage) interface{} { return map[string]interface{}{} })
+
+	go func() { _ = c.Run() }()
+
+	w := NewWidgets(c, WithThrottle(time.Second))
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.cblock.Lock()
+	defer c.cblock.Unlock()
+
+	for path, subs := range c.callbacks {
+		for _, v := range subs {
+			if want := path == EventUserInterfaceWidgetAction; v.coalesced != want {
+				t.Errorf("%s coalesced %v, want %v", path, v.coalesced, want)
+			}
+		}
+	}
+}
+
+func TestWidgetsResyncEvents(t *testing.T) {
+	c, f := newTestClient()
+	defer f.Close()
+
+	pushes := make(chan string, 16)
+
+	f.serve(func(method string, _ json.RawMessage) interface{} {
+		if method == string(widgetSetValueCommand) {
+			pushes <- method
+		}
+
+		return map[string]interface{}{}
+	})
+
+	go func() { _ = c.Run() }()
+
+	w := NewWidgets(c)
+	w.BindToggle("toggle", func() bool { return true }, func(bool) {})
+
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	<-pushes
+
+	expect := func(event string, want bool) {
+		t.Helper()
+
+		f.event(event)
+
+		select {
+		case <-pushes:
+			if !want {
+				t.Errorf("%s resynced the widgets", event)
+			}
+		case <-time.After(50 * time.Millisecond):
+			if want {
+				t.Errorf("%s did not resync the widgets", event)
+			}
+		}
+	}
+
+	expect(`{"Event":{"UserInterface":{"Extensions":{"Event":{"Changed":{"Signal":"toggle:on"}}}}}}`, false)
+	expect(`{"Event":{"UserInterface":{"Extensions":{"Widget":{"Action":{"WidgetId":"toggle","Type":"changed","Value":"on"}}}}}}`, false)
+	expect(`{"Event":{"UserInterface":{"Extensions":{"Panel":{"Open":{"PanelId":"panel"}}}}}}`, true)
+	expect(`{"Event":{"UserInterface":{"Extensions":{"Widget":{"LayoutUpdated":{}}}}}}`, true)
+}